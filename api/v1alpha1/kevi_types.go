@@ -31,6 +31,60 @@ const (
 // KeviSpec defines the desired state of Kevi
 type KeviSpec struct {
 	Packages []KeviSpecPackage `json:"packages,omitempty"`
+
+	// SelfHeal re-syncs packages whose live resources drift from their rendered manifests
+	SelfHeal bool `json:"selfHeal,omitempty"`
+
+	// ServiceAccountName is a ServiceAccount in the Kevi's namespace that packages are synced as, limiting the Kevi to
+	// the ServiceAccount's RBAC instead of the controller's
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Target is the cluster the Kevi's packages are synced to, defaulting to the controller's own cluster
+	Target *KeviTarget `json:"target,omitempty"`
+
+	// Suspend stops all syncs of the Kevi's packages until it is unset
+	Suspend bool `json:"suspend,omitempty"`
+
+	// RequireApproval holds new package revisions until the plan of changes they make is approved with the
+	// kevi.cattle.io/approved-plan annotation
+	RequireApproval bool `json:"requireApproval,omitempty"`
+
+	// RollbackTo pins every package to the digests recorded in the status history entry with this ID, which is kept in
+	// history while it's set, unset it to resume syncing the packages' current references
+	RollbackTo *int64 `json:"rollbackTo,omitempty"`
+
+	// AutoRollback re-syncs the last successful revision when a sync fails, including failed hooks and resources that
+	// turn degraded while the sync waits on them, and skips the failed revision until a new one is published. Resources
+	// that turn unhealthy after a sync succeeds don't trigger a rollback.
+	AutoRollback bool `json:"autoRollback,omitempty"`
+
+	// RevisionHistoryLimit is the number of history entries kept in status, defaults to 10
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// SyncWindows restrict when packages are synced, syncs outside of an allow window or inside a deny window are
+	// skipped until the window changes
+	SyncWindows []KeviSyncWindow `json:"syncWindows,omitempty"`
+}
+
+const (
+	KeviSyncWindowAllow = "allow"
+	KeviSyncWindowDeny  = "deny"
+)
+
+// KeviSyncWindow is a recurring period of time that syncs are allowed or denied
+type KeviSyncWindow struct {
+	// Kind is either allow or deny
+	// +kubebuilder:validation:Enum=allow;deny
+	Kind string `json:"kind"`
+
+	// Schedule is a cron expression for when the window opens, evaluated in UTC unless prefixed with CRON_TZ=
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open, such as 1h
+	Duration metav1.Duration `json:"duration"`
+
+	// ManualSync allows syncs requested with the kevi.cattle.io/reconcile-requested-at annotation regardless of the window
+	ManualSync bool `json:"manualSync,omitempty"`
 }
 
 type KeviSpecPackage struct {
@@ -38,6 +92,43 @@ type KeviSpecPackage struct {
 	Manifest KeviSpecPackageManifest `json:"manifest,omitempty"`
 	Chart    KeviSpecPackageChart    `json:"chart,omitempty"`
 	Images   []string                `json:"images,omitempty"`
+
+	// DependsOn lists the names of packages in the same Kevi that must be synced before this one
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// IgnoreDifferences excludes fields owned by other controllers from drift detection and syncing
+	IgnoreDifferences []KeviResourceIgnoreDifferences `json:"ignoreDifferences,omitempty"`
+
+	// SyncOptions configure how the package's resources are synced, individual resources can override them with
+	// the kevi.cattle.io/sync-options annotation
+	SyncOptions KeviSpecPackageSyncOptions `json:"syncOptions,omitempty"`
+}
+
+type KeviSpecPackageSyncOptions struct {
+	// Prune deletes resources that are no longer rendered, defaults to true
+	Prune *bool `json:"prune,omitempty"`
+
+	// PruneLast prunes resources only after every other resource is synced and healthy
+	PruneLast bool `json:"pruneLast,omitempty"`
+
+	// PruneExclusions are resources that are never pruned, such as PersistentVolumeClaims and Namespaces
+	PruneExclusions []KeviResourceSelector `json:"pruneExclusions,omitempty"`
+
+	// Replace uses replace/create instead of apply, useful for resources too large for apply's last applied annotation
+	Replace bool `json:"replace,omitempty"`
+
+	// ServerSideApply applies resources with server side apply
+	ServerSideApply bool `json:"serverSideApply,omitempty"`
+
+	// Validate toggles schema validation, defaults to true
+	Validate *bool `json:"validate,omitempty"`
+}
+
+// Matches returns true if the selector matches the given resource identity
+func (in *KeviResourceSelector) Matches(group, kind, namespace, name string) bool {
+	return in.Group == group && in.Kind == kind &&
+		(in.Name == "" || in.Name == name) &&
+		(in.Namespace == "" || in.Namespace == namespace)
 }
 
 func (in *KeviSpecPackage) Identify() string {
@@ -50,6 +141,26 @@ func (in *KeviSpecPackage) Identify() string {
 	return KeviPackageUnknowntype
 }
 
+// KeviResourceSelector matches resources by group and kind, and optionally by name and namespace
+type KeviResourceSelector struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// KeviResourceIgnoreDifferences selects fields of matching resources whose live values are left untouched
+type KeviResourceIgnoreDifferences struct {
+	KeviResourceSelector `json:",inline"`
+
+	// JSONPointers are RFC 6901 pointers to ignored fields, such as /spec/replicas
+	JSONPointers []string `json:"jsonPointers,omitempty"`
+
+	// JQPathExpressions are JQ style paths to ignored fields, supporting .field, [], [N] and select(.field == "value"),
+	// such as .spec.template.spec.containers[] | select(.name == "istio-proxy")
+	JQPathExpressions []string `json:"jqPathExpressions,omitempty"`
+}
+
 type KeviSpecPackageManifest struct {
 	Path string `json:"path"`
 }
@@ -62,7 +173,167 @@ type KeviSpecPackageChart struct {
 }
 
 // KeviStatus defines the observed state of Kevi
-type KeviStatus struct{}
+type KeviStatus struct {
+	ObservedGeneration int64               `json:"observedGeneration,omitempty"`
+	Packages           []KeviPackageStatus `json:"packages,omitempty"`
+
+	// LastHandledReconcileAt is the last kevi.cattle.io/reconcile-requested-at value that was synced
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
+	// Plan is the pending set of changes awaiting approval when RequireApproval is set
+	Plan *KeviPlan `json:"plan,omitempty"`
+
+	// History records every sync of the Kevi's packages, oldest first
+	History []KeviRevisionHistory `json:"history,omitempty"`
+
+	// Cluster is the state of the cluster the Kevi's packages are synced to
+	Cluster *KeviClusterStatus `json:"cluster,omitempty"`
+}
+
+// KeviTarget is a remote cluster a Kevi's packages are synced to
+type KeviTarget struct {
+	// KubeConfigSecretRef is a Secret in the Kevi's namespace holding the remote cluster's kubeconfig, when the Kevi
+	// sets a ServiceAccountName the ServiceAccount is impersonated in the remote cluster
+	KubeConfigSecretRef KeviSecretKeyRef `json:"kubeConfigSecretRef"`
+}
+
+// KeviSecretKeyRef selects a key of a Secret in the Kevi's namespace
+type KeviSecretKeyRef struct {
+	Name string `json:"name"`
+
+	// Key defaults to kubeconfig
+	Key string `json:"key,omitempty"`
+}
+
+// KeviClusterStatus is the state of the controller's cache of a cluster
+type KeviClusterStatus struct {
+	// Name is the kubeconfig Secret the cluster was connected with, or in-cluster for the controller's own cluster
+	Name string `json:"name"`
+
+	Server            string       `json:"server,omitempty"`
+	KubernetesVersion string       `json:"kubernetesVersion,omitempty"`
+	ResourcesCount    int          `json:"resourcesCount,omitempty"`
+	LastCacheSyncTime *metav1.Time `json:"lastCacheSyncTime,omitempty"`
+
+	// Message describes why the cluster couldn't be connected to or cached
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	KeviRevisionSucceeded  = "Succeeded"
+	KeviRevisionFailed     = "Failed"
+	KeviRevisionRolledBack = "RolledBack"
+)
+
+// KeviRevisionHistory is a single sync of a Kevi's packages
+type KeviRevisionHistory struct {
+	// ID identifies the entry, and increases with every sync
+	ID int64 `json:"id"`
+
+	Packages []KeviPackageRevision `json:"packages,omitempty"`
+	SyncedAt metav1.Time           `json:"syncedAt"`
+
+	// Result is one of Succeeded, Failed or RolledBack
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeviPackageRevision identifies the content a package was synced from
+type KeviPackageRevision struct {
+	Name string `json:"name"`
+
+	// Digest is the digest of the package's content in the registry
+	Digest string `json:"digest"`
+
+	// RenderKey is a hash of the digest and every input used to render it
+	RenderKey string `json:"renderKey"`
+
+	// Revision is a hash of the rendered manifests
+	Revision string `json:"revision"`
+}
+
+// Revision returns the history entry with the given ID, or nil if it isn't recorded
+func (in *KeviStatus) Revision(id int64) *KeviRevisionHistory {
+	for i := range in.History {
+		if in.History[i].ID == id {
+			return &in.History[i]
+		}
+	}
+	return nil
+}
+
+// KeviPlan is the set of changes syncing the Kevi's new package revisions would make
+type KeviPlan struct {
+	// Hash identifies the plan's contents, approving a plan sets the kevi.cattle.io/approved-plan annotation to it
+	Hash     string            `json:"hash"`
+	Packages []KeviPackagePlan `json:"packages,omitempty"`
+}
+
+// KeviPackagePlan is the set of changes syncing a single package's new revision would make
+type KeviPackagePlan struct {
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+
+	Created []KeviResourceStatus `json:"created,omitempty"`
+	Updated []KeviResourceStatus `json:"updated,omitempty"`
+	Deleted []KeviResourceStatus `json:"deleted,omitempty"`
+}
+
+// KeviPackageStatus defines the observed state of a single package
+type KeviPackageStatus struct {
+	Name string `json:"name"`
+
+	// Revision identifies the rendered content that was last synced
+	Revision     string       `json:"revision,omitempty"`
+	LastSyncedAt *metav1.Time `json:"lastSyncedAt,omitempty"`
+
+	// Digest and RenderKey identify the package content and render inputs that were last synced
+	Digest    string `json:"digest,omitempty"`
+	RenderKey string `json:"renderKey,omitempty"`
+
+	// Drifted lists the resources whose live state differs from the last synced revision
+	Drifted []KeviResourceStatus `json:"drifted,omitempty"`
+
+	// Hooks are the results of the hooks run by the most recent sync
+	Hooks []KeviHookStatus `json:"hooks,omitempty"`
+
+	// SyncError is the reason the most recent sync failed
+	SyncError string `json:"syncError,omitempty"`
+
+	// SyncSkipped is the reason a pending sync was skipped, such as a suspension or sync window
+	SyncSkipped string `json:"syncSkipped,omitempty"`
+}
+
+// KeviHookStatus is the result of a single hook run during a sync
+type KeviHookStatus struct {
+	KeviResourceStatus `json:",inline"`
+
+	// HookType is the sync phase the hook ran in, one of PreSync, Sync, PostSync or SyncFail
+	HookType string `json:"hookType"`
+
+	// Phase is the hook's outcome, such as Running, Succeeded or Failed
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeviResourceStatus identifies a single resource managed by a package
+type KeviResourceStatus struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// PackageStatus returns the status of the named package, or nil if it has never been observed
+func (in *KeviStatus) PackageStatus(name string) *KeviPackageStatus {
+	for i := range in.Packages {
+		if in.Packages[i].Name == name {
+			return &in.Packages[i]
+		}
+	}
+	return nil
+}
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
@@ -31,7 +31,7 @@ func (in *Kevi) DeepCopyInto(out *Kevi) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Kevi.
@@ -52,6 +52,41 @@ func (in *Kevi) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviClusterStatus) DeepCopyInto(out *KeviClusterStatus) {
+	*out = *in
+	if in.LastCacheSyncTime != nil {
+		in, out := &in.LastCacheSyncTime, &out.LastCacheSyncTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviClusterStatus.
+func (in *KeviClusterStatus) DeepCopy() *KeviClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviHookStatus) DeepCopyInto(out *KeviHookStatus) {
+	*out = *in
+	out.KeviResourceStatus = in.KeviResourceStatus
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviHookStatus.
+func (in *KeviHookStatus) DeepCopy() *KeviHookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviHookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeviList) DeepCopyInto(out *KeviList) {
 	*out = *in
@@ -84,6 +119,194 @@ func (in *KeviList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviPackagePlan) DeepCopyInto(out *KeviPackagePlan) {
+	*out = *in
+	if in.Created != nil {
+		in, out := &in.Created, &out.Created
+		*out = make([]KeviResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Updated != nil {
+		in, out := &in.Updated, &out.Updated
+		*out = make([]KeviResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Deleted != nil {
+		in, out := &in.Deleted, &out.Deleted
+		*out = make([]KeviResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviPackagePlan.
+func (in *KeviPackagePlan) DeepCopy() *KeviPackagePlan {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviPackagePlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviPackageRevision) DeepCopyInto(out *KeviPackageRevision) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviPackageRevision.
+func (in *KeviPackageRevision) DeepCopy() *KeviPackageRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviPackageRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviPackageStatus) DeepCopyInto(out *KeviPackageStatus) {
+	*out = *in
+	if in.LastSyncedAt != nil {
+		in, out := &in.LastSyncedAt, &out.LastSyncedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Drifted != nil {
+		in, out := &in.Drifted, &out.Drifted
+		*out = make([]KeviResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]KeviHookStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviPackageStatus.
+func (in *KeviPackageStatus) DeepCopy() *KeviPackageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviPackageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviPlan) DeepCopyInto(out *KeviPlan) {
+	*out = *in
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]KeviPackagePlan, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviPlan.
+func (in *KeviPlan) DeepCopy() *KeviPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviResourceIgnoreDifferences) DeepCopyInto(out *KeviResourceIgnoreDifferences) {
+	*out = *in
+	out.KeviResourceSelector = in.KeviResourceSelector
+	if in.JSONPointers != nil {
+		in, out := &in.JSONPointers, &out.JSONPointers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.JQPathExpressions != nil {
+		in, out := &in.JQPathExpressions, &out.JQPathExpressions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviResourceIgnoreDifferences.
+func (in *KeviResourceIgnoreDifferences) DeepCopy() *KeviResourceIgnoreDifferences {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviResourceIgnoreDifferences)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviResourceSelector) DeepCopyInto(out *KeviResourceSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviResourceSelector.
+func (in *KeviResourceSelector) DeepCopy() *KeviResourceSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviResourceSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviResourceStatus) DeepCopyInto(out *KeviResourceStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviResourceStatus.
+func (in *KeviResourceStatus) DeepCopy() *KeviResourceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviResourceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviRevisionHistory) DeepCopyInto(out *KeviRevisionHistory) {
+	*out = *in
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]KeviPackageRevision, len(*in))
+		copy(*out, *in)
+	}
+	in.SyncedAt.DeepCopyInto(&out.SyncedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviRevisionHistory.
+func (in *KeviRevisionHistory) DeepCopy() *KeviRevisionHistory {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviRevisionHistory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviSecretKeyRef) DeepCopyInto(out *KeviSecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviSecretKeyRef.
+func (in *KeviSecretKeyRef) DeepCopy() *KeviSecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviSecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeviSpec) DeepCopyInto(out *KeviSpec) {
 	*out = *in
@@ -94,6 +317,26 @@ func (in *KeviSpec) DeepCopyInto(out *KeviSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(KeviTarget)
+		**out = **in
+	}
+	if in.RollbackTo != nil {
+		in, out := &in.RollbackTo, &out.RollbackTo
+		*out = new(int64)
+		**out = **in
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SyncWindows != nil {
+		in, out := &in.SyncWindows, &out.SyncWindows
+		*out = make([]KeviSyncWindow, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviSpec.
@@ -116,6 +359,19 @@ func (in *KeviSpecPackage) DeepCopyInto(out *KeviSpecPackage) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IgnoreDifferences != nil {
+		in, out := &in.IgnoreDifferences, &out.IgnoreDifferences
+		*out = make([]KeviResourceIgnoreDifferences, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.SyncOptions.DeepCopyInto(&out.SyncOptions)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviSpecPackage.
@@ -158,9 +414,63 @@ func (in *KeviSpecPackageManifest) DeepCopy() *KeviSpecPackageManifest {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviSpecPackageSyncOptions) DeepCopyInto(out *KeviSpecPackageSyncOptions) {
+	*out = *in
+	if in.Prune != nil {
+		in, out := &in.Prune, &out.Prune
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PruneExclusions != nil {
+		in, out := &in.PruneExclusions, &out.PruneExclusions
+		*out = make([]KeviResourceSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.Validate != nil {
+		in, out := &in.Validate, &out.Validate
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviSpecPackageSyncOptions.
+func (in *KeviSpecPackageSyncOptions) DeepCopy() *KeviSpecPackageSyncOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviSpecPackageSyncOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeviStatus) DeepCopyInto(out *KeviStatus) {
 	*out = *in
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]KeviPackageStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(KeviPlan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]KeviRevisionHistory, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Cluster != nil {
+		in, out := &in.Cluster, &out.Cluster
+		*out = new(KeviClusterStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviStatus.
@@ -172,3 +482,35 @@ func (in *KeviStatus) DeepCopy() *KeviStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviSyncWindow) DeepCopyInto(out *KeviSyncWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviSyncWindow.
+func (in *KeviSyncWindow) DeepCopy() *KeviSyncWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviSyncWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeviTarget) DeepCopyInto(out *KeviTarget) {
+	*out = *in
+	out.KubeConfigSecretRef = in.KubeConfigSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeviTarget.
+func (in *KeviTarget) DeepCopy() *KeviTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(KeviTarget)
+	in.DeepCopyInto(out)
+	return out
+}
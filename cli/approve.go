@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/controllers"
+)
+
+func addApprove(parent *cobra.Command) {
+	var (
+		namespace string
+		yes       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "approve NAME",
+		Short: "show and approve the pending plan of a kevi",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+
+			c, err := kubeClient()
+			if err != nil {
+				return err
+			}
+
+			var kevi v1alpha1.Kevi
+			if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: args[0]}, &kevi); err != nil {
+				return err
+			}
+
+			plan := kevi.Status.Plan
+			if plan == nil {
+				l.Info().Msgf("Kevi [%s/%s] has no pending plan", namespace, args[0])
+				return nil
+			}
+
+			printPlan(os.Stdout, plan)
+
+			if !yes {
+				fmt.Printf("Approve plan [%s]? [y/N]: ", plan.Hash)
+				answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && err != io.EOF {
+					return err
+				}
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					l.Info().Msgf("Plan [%s] was not approved", plan.Hash)
+					return nil
+				}
+			}
+
+			patch := client.MergeFrom(kevi.DeepCopy())
+			annotations := kevi.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[controllers.ApprovedPlanAnnotation] = plan.Hash
+			kevi.SetAnnotations(annotations)
+
+			if err := c.Patch(ctx, &kevi, patch); err != nil {
+				return err
+			}
+
+			l.Info().Msgf("Approved plan [%s] of [%s/%s]", plan.Hash, namespace, args[0])
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&namespace, "namespace", "n", "default", "Namespace of the kevi.")
+	f.BoolVarP(&yes, "yes", "y", false, "Approve the plan without prompting.")
+
+	parent.AddCommand(cmd)
+}
+
+func printPlan(w io.Writer, plan *v1alpha1.KeviPlan) {
+	fmt.Fprintf(w, "Plan %s\n", plan.Hash)
+	for _, pp := range plan.Packages {
+		fmt.Fprintf(w, "\nPackage %s (revision %.12s)\n", pp.Name, pp.Revision)
+		for _, change := range []struct {
+			symbol    string
+			resources []v1alpha1.KeviResourceStatus
+		}{
+			{"+", pp.Created},
+			{"~", pp.Updated},
+			{"-", pp.Deleted},
+		} {
+			for _, res := range change.resources {
+				fmt.Fprintf(w, "  %s %s\n", change.symbol, resourceName(res))
+			}
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func resourceName(res v1alpha1.KeviResourceStatus) string {
+	kind := res.Kind
+	if res.Group != "" {
+		kind += "." + res.Group
+	}
+	if res.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", kind, res.Namespace, res.Name)
+	}
+	return fmt.Sprintf("%s %s", kind, res.Name)
+}
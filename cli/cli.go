@@ -47,7 +47,13 @@ func Cli() *cobra.Command {
 	addManager(cmd)
 	addPack(cmd)
 	addCopy(cmd)
+	addInstall(cmd)
 	addDeploy(cmd)
+	addUninstall(cmd)
+	addMirrors(cmd)
+	addSync(cmd)
+	addApprove(cmd)
+	addRollback(cmd)
 	version.AddVersion(cmd)
 
 	return cmd
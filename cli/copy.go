@@ -1,16 +1,21 @@
 package cli
 
 import (
+	"context"
+	"fmt"
+
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 	"oras.land/oras-go/pkg/content"
 
+	"cattle.io/kevi/api/v1alpha1"
 	"cattle.io/kevi/pkg/pack"
 )
 
 func addCopy(parent *cobra.Command) {
 	var (
-		storePath string
+		storePath          string
+		relocationStrategy string
 	)
 
 	cmd := &cobra.Command{
@@ -37,7 +42,13 @@ func addCopy(parent *cobra.Command) {
 				return err
 			}
 
-			descs, err := s.CopyAll(ctx, registry, ropts)
+			strategy, err := storeRelocationStrategy(ctx, s, relocationStrategy)
+			if err != nil {
+				return err
+			}
+
+			l.Info().Msgf("Relocating images with the [%s] strategy", strategy)
+			descs, err := s.CopyAll(ctx, registry, ropts, strategy)
 			if err != nil {
 				return err
 			}
@@ -52,6 +63,28 @@ func addCopy(parent *cobra.Command) {
 
 	f := cmd.Flags()
 	f.StringVarP(&storePath, "store", "s", "./store", "Path to store.")
+	f.StringVar(&relocationStrategy, "relocation-strategy", "", "How images are mapped to registry repositories, one of repository, host or hash. Defaults to the strategy the store was packed with.")
 
 	parent.AddCommand(cmd)
 }
+
+// storeRelocationStrategy returns the parsed strategy when one is given, otherwise the strategy the store's kevis were
+// packed with
+func storeRelocationStrategy(ctx context.Context, s *pack.Oci, strategy string) (pack.RelocationStrategy, error) {
+	if strategy != "" {
+		return pack.ParseRelocationStrategy(strategy)
+	}
+
+	packed := ""
+	if err := s.WalkKevis(ctx, func(reference string, k *v1alpha1.Kevi) error {
+		st := k.GetAnnotations()[pack.RelocationStrategyAnnotation]
+		if packed != "" && st != packed {
+			return fmt.Errorf("kevis in the store were packed with both the %s and %s relocation strategies", packed, st)
+		}
+		packed = st
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return pack.ParseRelocationStrategy(packed)
+}
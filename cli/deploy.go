@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/fluxcd/pkg/ssa"
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -15,12 +15,10 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"oras.land/oras-go/pkg/content"
-	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/controllers"
 	"cattle.io/kevi/pkg/install"
 	"cattle.io/kevi/pkg/pack"
 )
@@ -34,6 +32,8 @@ func addDeploy(parent *cobra.Command) {
 		password  string
 		insecure  bool
 		plainHttp bool
+
+		flags installFlags
 	)
 
 	cmd := &cobra.Command{
@@ -65,15 +65,6 @@ func addDeploy(parent *cobra.Command) {
 				return err
 			}
 
-			l.Info().Msgf("Installing kevi into cluster")
-			cs, err := runInstall(ctx, rmgr, registry, install.Options{
-				Namespace: defaultNamespace,
-			})
-			if err != nil {
-				return err
-			}
-			fmt.Println(cs.String())
-
 			for _, p := range packages {
 				fmt.Printf("Unpacking package [%s] to [%s]\n", p, storePath)
 				if err := archiver.Unarchive(p, storePath); err != nil {
@@ -87,8 +78,29 @@ func addDeploy(parent *cobra.Command) {
 				return err
 			}
 
-			l.Info().Msgf("Relocating content from [%s] --> [%s]", storePath, registry)
-			descs, err := s.CopyAll(ctx, registry, ropts)
+			strategy, err := storeRelocationStrategy(ctx, s, flags.relocationStrategy)
+			if err != nil {
+				return err
+			}
+
+			iopts, err := flags.options(strategy)
+			if err != nil {
+				return err
+			}
+
+			l.Info().Msgf("Installing kevi into cluster")
+			binaries, err := flags.binaries(ctx, s)
+			if err != nil {
+				return err
+			}
+			cs, err := runInstall(ctx, rmgr, registry, iopts, binaries, flags.force)
+			if err != nil {
+				return err
+			}
+			fmt.Println(cs.String())
+
+			l.Info().Msgf("Relocating content from [%s] --> [%s] with the [%s] strategy", storePath, registry, strategy)
+			descs, err := s.CopyAll(ctx, registry, ropts, strategy)
 			if err != nil {
 				return err
 			}
@@ -96,33 +108,24 @@ func addDeploy(parent *cobra.Command) {
 				l.Info().Msgf("Successfully relocated [%s]", desc.Annotations[ocispec.AnnotationRefName])
 			}
 
-			// search for any deployable configs in the store
-			if err := s.Walk(func(reference string, desc ocispec.Descriptor) error {
-				// TODO: Better way to identify known packages, preferably an annotation
-				spl := strings.Split(reference, "/kevi-")
-				if len(spl) > 1 {
-					l.Info().Msgf("Found kevi configuration in store [%s], installing...", reference)
-					k, err := fetchKevi(ctx, s, reference)
-					if err != nil {
-						return err
-					}
-
-					data, err := json.Marshal(k)
-					if err != nil {
-						return err
-					}
-
-					u := new(unstructured.Unstructured)
-					if err := u.UnmarshalJSON(data); err != nil {
-						return err
-					}
-
-					cs, err := rmgr.Apply(ctx, u, ssa.ApplyOptions{})
-					if err != nil {
-						return err
-					}
-					fmt.Println(cs)
+			// install every kevi packed in the store
+			if err := s.WalkKevis(ctx, func(reference string, k *v1alpha1.Kevi) error {
+				l.Info().Msgf("Found kevi configuration in store [%s], installing...", reference)
+				data, err := json.Marshal(k)
+				if err != nil {
+					return err
+				}
+
+				u := new(unstructured.Unstructured)
+				if err := u.UnmarshalJSON(data); err != nil {
+					return err
 				}
+
+				cs, err := rmgr.Apply(ctx, u, ssa.ApplyOptions{})
+				if err != nil {
+					return err
+				}
+				fmt.Println(cs)
 				return nil
 			}); err != nil {
 				return err
@@ -139,107 +142,115 @@ func addDeploy(parent *cobra.Command) {
 	f.StringVarP(&password, "password", "p", "", "Password to use for an authenticated registry.")
 	f.BoolVar(&insecure, "insecure", false, "Toggle insecure mode when connecting to registry.")
 	f.BoolVar(&plainHttp, "plain-http", false, "Toggle https enforcement when connecting to registry.")
+	flags.addFlags(f)
 
 	parent.AddCommand(cmd)
 }
 
-func fetchKevi(ctx context.Context, oci *pack.Oci, reference string) (*v1alpha1.Kevi, error) {
-	_, desc, err := oci.Resolve(ctx, reference)
-	if err != nil {
-		return nil, err
-	}
+// runInstall pushes the controller's image, a multi-arch index when there are binaries for several platforms, and
+// installs kevi running it. An installation of the same version and options is left as it is, and an installation of
+// a newer version is only downgraded when forced.
+func runInstall(ctx context.Context, rmgr *ssa.ResourceManager, registry string, opts install.Options, binaries []install.Binary, force bool) (*ssa.ChangeSet, error) {
+	opts.Registry = registry
 
-	rc, err := oci.Fetch(ctx, desc)
+	installed, err := install.Detect(ctx, rmgr.Client(), opts.Namespace)
 	if err != nil {
 		return nil, err
 	}
-	defer rc.Close()
-
-	var m ocispec.Manifest
-	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+	action, err := install.Plan(installed, opts)
+	if err != nil {
 		return nil, err
 	}
 
-	for _, l := range m.Layers {
-		rc, err := oci.Fetch(ctx, l)
-		if err != nil {
-			return nil, err
+	switch action {
+	case install.ActionUnchanged:
+		if !force {
+			fmt.Printf("kevi %s is already installed in [%s]\n", installed.Version, opts.Namespace)
+			return ssa.NewChangeSet(), nil
 		}
-
-		var k v1alpha1.Kevi
-		if err := json.NewDecoder(rc).Decode(&k); err != nil {
-			rc.Close()
-			continue
+	case install.ActionDowngrade:
+		if !force {
+			return nil, fmt.Errorf("refusing to downgrade kevi in [%s] from %s to %s, use --force to downgrade", opts.Namespace, installed.Version, opts.Version)
 		}
-		rc.Close()
-		return &k, nil
 	}
-	return nil, fmt.Errorf("unable to parse kevi object from %s", reference)
-}
-
-func runInstall(ctx context.Context, rmgr *ssa.ResourceManager, registry string, opts install.Options) (*ssa.ChangeSet, error) {
-	img, err := install.Build(ctx)
-	if err != nil {
-		return nil, err
+	if installed != nil {
+		fmt.Printf("Upgrading kevi in [%s] from %s to %s\n", opts.Namespace, installed.Version, opts.Version)
 	}
 
-	h, err := img.Digest()
+	repon, err := name.NewRepository(install.ControllerRepository, name.WithDefaultRegistry(registry))
 	if err != nil {
 		return nil, err
 	}
 
-	repon, err := name.NewRepository("kevi/kevi-controller", name.WithDefaultRegistry(registry))
-	if err != nil {
-		return nil, err
-	}
+	var refn name.Digest
+	if len(binaries) > 0 {
+		idx, err := install.BuildIndex(ctx, binaries)
+		if err != nil {
+			return nil, err
+		}
+		h, err := idx.Digest()
+		if err != nil {
+			return nil, err
+		}
 
-	refn := repon.Digest(h.String())
-	fmt.Println("Pushing created image: ", refn.Name())
-	if err := remote.Write(refn, img); err != nil {
-		return nil, err
+		refn = repon.Digest(h.String())
+		fmt.Println("Pushing created image index: ", refn.Name())
+		if err := remote.WriteIndex(refn, idx); err != nil {
+			return nil, err
+		}
+	} else {
+		img, err := install.Build(ctx)
+		if err != nil {
+			return nil, err
+		}
+		h, err := img.Digest()
+		if err != nil {
+			return nil, err
+		}
+
+		refn = repon.Digest(h.String())
+		fmt.Println("Pushing created image: ", refn.Name())
+		if err := remote.Write(refn, img); err != nil {
+			return nil, err
+		}
 	}
-	opts.Registry = registry
 	opts.Image = refn.Name()
 
 	objs, err := install.Generate(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
+	// installing into an existing namespace leaves it as it is, so uninstalling never deletes it
+	objs, err = install.WithoutForeignNamespace(ctx, rmgr.Client(), opts.Namespace, objs)
+	if err != nil {
+		return nil, err
+	}
 
-	// Ensure namespace is applied first
+	// the namespace and CRD are applied and ready first, and the controller last, so an upgraded controller never
+	// runs against an outdated CRD or RBAC
+	var controller, rest []*unstructured.Unstructured
 	for _, obj := range objs {
-		if obj.GetKind() == "Namespace" {
-			if _, err := rmgr.Apply(ctx, obj, ssa.ApplyOptions{}); err != nil {
-				return nil, err
-			}
+		if obj.GetKind() == "Deployment" {
+			controller = append(controller, obj)
+		} else {
+			rest = append(rest, obj)
 		}
 	}
 
-	return rmgr.ApplyAll(ctx, objs, ssa.ApplyOptions{
-		Force:       false,
-		Exclusions:  nil,
-		WaitTimeout: 0,
-	})
-}
-
-func resourceManager() (*ssa.ResourceManager, error) {
-	cfg := ctrl.GetConfigOrDie()
-
-	restMapper, err := apiutil.NewDynamicRESTMapper(cfg)
+	cs, err := rmgr.ApplyAllStaged(ctx, rest, ssa.ApplyOptions{WaitTimeout: time.Minute})
 	if err != nil {
 		return nil, err
 	}
-
-	kc, err := client.New(cfg, client.Options{Mapper: restMapper})
+	ccs, err := rmgr.ApplyAll(ctx, controller, ssa.ApplyOptions{})
 	if err != nil {
 		return nil, err
 	}
+	cs.Append(ccs.Entries)
+	return cs, nil
+}
 
-	poller := polling.NewStatusPoller(kc, restMapper)
-	return ssa.NewResourceManager(kc, poller, ssa.Owner{
-		Field: "kevi",
-		Group: "cattle.io",
-	}), nil
+func resourceManager() (*ssa.ResourceManager, error) {
+	return controllers.NewResourceManager(ctrl.GetConfigOrDie())
 }
 
 func pingRegistry(ctx context.Context, registry string, opts content.RegistryOptions) (*content.Registry, error) {
@@ -0,0 +1,289 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"cattle.io/kevi/cli/version"
+	"cattle.io/kevi/pkg/install"
+	"cattle.io/kevi/pkg/pack"
+	"cattle.io/kevi/pkg/webhook"
+)
+
+// installFlags are the flags of every command that installs kevi
+type installFlags struct {
+	namespace             string
+	requireServiceAccount bool
+	relocationStrategy    string
+	excludedNamespaces    []string
+	pullSecret            string
+	imageRules            []string
+
+	replicas            int32
+	requests            map[string]string
+	limits              map[string]string
+	nodeSelector        map[string]string
+	tolerations         []string
+	priorityClassName   string
+	podDisruptionBudget bool
+
+	controllerBinaries map[string]string
+
+	force bool
+}
+
+func (o *installFlags) addFlags(f *pflag.FlagSet) {
+	defaults := install.MakeDefaultOptions()
+
+	f.StringVarP(&o.namespace, "namespace", "n", defaults.Namespace, "Namespace kevi is installed in.")
+	f.BoolVar(&o.requireServiceAccount, "require-service-account", false, "Install without cluster-wide write access, requiring kevis to set a service account.")
+	f.StringVar(&o.relocationStrategy, "relocation-strategy", "", "How images are mapped to registry repositories, one of repository, host or hash. Defaults to the strategy the store was packed with when deploying, otherwise repository.")
+	f.StringSliceVar(&o.excludedNamespaces, "excluded-namespaces", webhook.DefaultExcludedNamespaces, "Namespaces whose pods are never relocated, kevi's own namespace is always excluded.")
+	f.StringVar(&o.pullSecret, "pull-secret", "", "Name of a Secret in the kevi namespace with credentials for the registry, replicated to the namespaces of relocated pods.")
+	f.StringArrayVar(&o.imageRules, "image-rule", nil, "Also relocate images in other resources, as resource.group=path[,path...] such as prometheuses.monitoring.coreos.com={.spec.image}.")
+
+	f.Int32Var(&o.replicas, "replicas", defaults.Replicas, "Replicas of the manager, more than one elects a leader.")
+	f.StringToStringVar(&o.requests, "requests", resourceFlag(defaults.Resources.Requests), "Resource requests of the manager.")
+	f.StringToStringVar(&o.limits, "limits", resourceFlag(defaults.Resources.Limits), "Resource limits of the manager.")
+	f.StringToStringVar(&o.nodeSelector, "node-selector", nil, "Node labels the manager is scheduled on.")
+	f.StringArrayVar(&o.tolerations, "toleration", nil, "Taint the manager tolerates, as key[=value][:effect].")
+	f.StringVar(&o.priorityClassName, "priority-class", "", "Priority class of the manager's pods.")
+	f.BoolVar(&o.podDisruptionBudget, "pod-disruption-budget", false, "Limit voluntary disruptions of the manager to one replica at a time.")
+	f.StringToStringVar(&o.controllerBinaries, "controller-binary", nil, "Kevi binaries for other platforms as os/arch=path, assembled into a multi-arch controller image.")
+	f.BoolVar(&o.force, "force", false, "Reinstall kevi when the same version is installed, and allow downgrading a newer version.")
+}
+
+// options returns the install options of the flags, relocating images with strategy
+func (o *installFlags) options(strategy pack.RelocationStrategy) (install.Options, error) {
+	opts := install.MakeDefaultOptions()
+	opts.Version = version.GetVersionInfo().GitVersion
+	opts.Namespace = o.namespace
+	opts.RequireServiceAccount = o.requireServiceAccount
+	opts.RelocationStrategy = string(strategy)
+	opts.PullSecret = o.pullSecret
+	opts.Replicas = o.replicas
+	opts.NodeSelector = o.nodeSelector
+	opts.PriorityClassName = o.priorityClassName
+	opts.PodDisruptionBudget = o.podDisruptionBudget
+
+	if o.replicas < 1 {
+		return install.Options{}, fmt.Errorf("--replicas must be at least 1")
+	}
+
+	// the manager's own pods can't wait on its webhook
+	opts.ExcludedNamespaces = append([]string{}, o.excludedNamespaces...)
+	if !contains(opts.ExcludedNamespaces, o.namespace) {
+		opts.ExcludedNamespaces = append(opts.ExcludedNamespaces, o.namespace)
+	}
+
+	rules, err := parseImageRules(o.imageRules)
+	if err != nil {
+		return install.Options{}, err
+	}
+	opts.ImageRules = rules
+
+	if opts.Resources.Requests, err = parseResources(o.requests); err != nil {
+		return install.Options{}, err
+	}
+	if opts.Resources.Limits, err = parseResources(o.limits); err != nil {
+		return install.Options{}, err
+	}
+
+	opts.Tolerations = nil
+	for _, t := range o.tolerations {
+		toleration, err := parseToleration(t)
+		if err != nil {
+			return install.Options{}, err
+		}
+		opts.Tolerations = append(opts.Tolerations, toleration)
+	}
+
+	return opts, nil
+}
+
+// binaries returns the binaries the controller's image is assembled from, preferring those given by flag, then those
+// packed in the store s, then the executed binary when it's built for linux. It's nil when there are none besides the
+// executed binary.
+func (o *installFlags) binaries(ctx context.Context, s *pack.Oci) ([]install.Binary, error) {
+	byPlatform := make(map[string]install.Binary)
+
+	if s != nil {
+		packed, err := s.ControllerBinaries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for platform, desc := range packed {
+			p, err := pack.ParsePlatform(platform)
+			if err != nil {
+				return nil, err
+			}
+			desc := desc
+			byPlatform[platform] = install.Binary{Platform: p, Open: func() (io.ReadCloser, error) {
+				return s.Fetch(ctx, desc)
+			}}
+		}
+	}
+
+	for platform, path := range o.controllerBinaries {
+		p, err := pack.ParsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		path := path
+		byPlatform[platform] = install.Binary{Platform: p, Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}}
+	}
+
+	if len(byPlatform) == 0 {
+		return nil, nil
+	}
+
+	// the controller only runs on linux, so the executed binary is only included when it's built for linux
+	e, err := install.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := byPlatform[e.Platform.OS+"/"+e.Platform.Architecture]; !ok && e.Platform.OS == "linux" {
+		byPlatform[e.Platform.OS+"/"+e.Platform.Architecture] = e
+	}
+
+	var platforms []string
+	for p := range byPlatform {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+
+	var binaries []install.Binary
+	for _, p := range platforms {
+		binaries = append(binaries, byPlatform[p])
+	}
+	return binaries, nil
+}
+
+func resourceFlag(l corev1.ResourceList) map[string]string {
+	m := make(map[string]string)
+	for k, v := range l {
+		m[string(k)] = v.String()
+	}
+	return m
+}
+
+func parseResources(m map[string]string) (corev1.ResourceList, error) {
+	l := make(corev1.ResourceList)
+	for k, v := range m {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s quantity %q: %w", k, v, err)
+		}
+		l[corev1.ResourceName(k)] = q
+	}
+	return l, nil
+}
+
+// parseToleration parses a toleration written like a taint, key[=value][:effect], tolerating every value of key when
+// the value is omitted and every effect when the effect is omitted
+func parseToleration(s string) (corev1.Toleration, error) {
+	t := corev1.Toleration{Operator: corev1.TolerationOpExists}
+
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		t.Effect = corev1.TaintEffect(s[i+1:])
+		s = s[:i]
+		switch t.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return corev1.Toleration{}, fmt.Errorf("unknown taint effect %q", t.Effect)
+		}
+	}
+
+	t.Key = s
+	if i := strings.Index(s, "="); i >= 0 {
+		t.Key, t.Value, t.Operator = s[:i], s[i+1:], corev1.TolerationOpEqual
+	}
+	if t.Key == "" {
+		return corev1.Toleration{}, fmt.Errorf("toleration %q must set a key", s)
+	}
+	return t, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func addInstall(parent *cobra.Command) {
+	var (
+		flags  installFlags
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "install kevi into a cluster without deploying packages",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+			registry := args[0]
+
+			strategy, err := pack.ParseRelocationStrategy(flags.relocationStrategy)
+			if err != nil {
+				return err
+			}
+			opts, err := flags.options(strategy)
+			if err != nil {
+				return err
+			}
+
+			binaries, err := flags.binaries(ctx, nil)
+			if err != nil {
+				return err
+			}
+
+			if output != "" {
+				opts.Registry = registry
+				refn, err := install.Export(ctx, output, opts, binaries)
+				if err != nil {
+					return err
+				}
+				l.Info().Msgf("Wrote the manifests to [%s]", filepath.Join(output, install.ManifestsFile))
+				l.Info().Msgf("Wrote the controller image to [%s], push it to [%s] before applying the manifests", filepath.Join(output, install.ImageLayout), refn.Context().Name())
+				return nil
+			}
+
+			l.Info().Msgf("Setting up connection to cluster")
+			rmgr, err := resourceManager()
+			if err != nil {
+				return err
+			}
+
+			l.Info().Msgf("Installing kevi into namespace [%s]", opts.Namespace)
+			cs, err := runInstall(ctx, rmgr, registry, opts, binaries, flags.force)
+			if err != nil {
+				return err
+			}
+			fmt.Println(cs.String())
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	flags.addFlags(f)
+	f.StringVarP(&output, "output", "o", "", "Write the manifests and the controller image as an OCI layout to a directory, instead of installing into the cluster.")
+
+	parent.AddCommand(cmd)
+}
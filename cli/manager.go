@@ -1,14 +1,17 @@
 package cli
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/argoproj/gitops-engine/pkg/cache"
 	"github.com/argoproj/gitops-engine/pkg/engine"
 	"github.com/go-logr/logr"
 	"github.com/open-policy-agent/cert-controller/pkg/rotator"
 	"github.com/spf13/cobra"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"oras.land/oras-go/pkg/content"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -18,6 +21,7 @@ import (
 
 	"cattle.io/kevi/controllers"
 	"cattle.io/kevi/pkg/fetcher"
+	"cattle.io/kevi/pkg/pack"
 	"cattle.io/kevi/pkg/webhook"
 )
 
@@ -29,7 +33,24 @@ func addManager(parent *cobra.Command) {
 		dev                  bool
 		certsDir             string
 
-		registry string
+		registry                string
+		cacheSize               int64
+		maxConcurrentReconciles int
+		cacheDir                string
+		maxPackageSize          int64
+		driftInterval           time.Duration
+		requireServiceAccount   bool
+		allowUnsafeKubeConfigs  bool
+		relocateImages          bool
+		relocationStrategy      string
+		checkImages             bool
+		checkImagesTTL          time.Duration
+		checkImagesTimeout      time.Duration
+		denyMissingImages       bool
+		excludedNamespaces      []string
+		pullSecret              string
+		imageRules              []string
+		namespace               string
 	)
 
 	cmd := &cobra.Command{
@@ -43,18 +64,14 @@ func addManager(parent *cobra.Command) {
 
 			ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+			strategy, err := pack.ParseRelocationStrategy(relocationStrategy)
+			if err != nil {
+				return err
+			}
+
 			cfg := ctrl.GetConfigOrDie()
 
-			c := cache.NewClusterCache(cfg,
-				cache.SetLogr(ctrl.Log),
-				cache.SetPopulateResourceInfoHandler(func(un *unstructured.Unstructured, isRoot bool) (info interface{}, cacheManifest bool) {
-					gcMark := un.GetAnnotations()[controllers.GCAnnotationMark]
-					info = &controllers.GCMark{Mark: un.GetAnnotations()[controllers.GCAnnotationMark]}
-					// cache resources that has that mark to improve performance
-					cacheManifest = gcMark != ""
-					return
-				}),
-			)
+			c := controllers.NewClusterCache(cfg, cache.SetLogr(ctrl.Log))
 
 			gengine := engine.NewEngine(cfg, c, engine.WithLogr(ctrl.Log))
 			cleanup, err := gengine.Run()
@@ -90,12 +107,12 @@ func addManager(parent *cobra.Command) {
 			cr := &rotator.CertRotator{
 				SecretKey: types.NamespacedName{
 					Name:      mwhCertsName,
-					Namespace: defaultNamespace,
+					Namespace: namespace,
 				},
 				CAName:         "kevi-ca",
 				CAOrganization: "kevi",
 				CertDir:        certsDir,
-				DNSName:        "kevi-controller-manager.kevi-system.svc",
+				DNSName:        fmt.Sprintf("kevi-controller-manager.%s.svc", namespace),
 				IsReady:        setupFinished,
 				Webhooks: []rotator.WebhookInfo{
 					{Name: mwhName, Type: rotator.Mutating},
@@ -118,13 +135,76 @@ func addManager(parent *cobra.Command) {
 				os.Exit(1)
 			}
 
+			rm, err := resourceManager()
+			if err != nil {
+				return err
+			}
+
 			reconciler := &controllers.KeviReconciler{
 				Client:  mgr.GetClient(),
 				Scheme:  mgr.GetScheme(),
 				Fetcher: registryFetcher,
 				Engine:  gengine,
+				Cache:   pack.NewCache(cacheSize),
+				LoadOptions: []pack.LoadOption{
+					pack.WithStoreDir(cacheDir),
+					pack.WithMaxSize(maxPackageSize),
+				},
+
+				MaxConcurrentReconciles: maxConcurrentReconciles,
+
+				ClusterCache:  c,
+				DriftInterval: driftInterval,
+
+				ResourceManager: rm,
+
+				Config:                cfg,
+				RequireServiceAccount: requireServiceAccount,
+
+				AllowUnsafeKubeConfigs: allowUnsafeKubeConfigs,
+
+				RelocationStrategy: strategy,
+			}
+			if relocateImages {
+				reconciler.RelocateRegistry = registry
 			}
-			go initControllers(mgr, log, reconciler, registry, setupFinished)
+			relocatorOpts := []webhook.RelocatorOption{webhook.WithExcludedNamespaces(excludedNamespaces...)}
+			if checkImages || denyMissingImages {
+				relocatorOpts = append(relocatorOpts, webhook.WithExistenceCheck(checkImagesTTL, checkImagesTimeout))
+			}
+			if denyMissingImages {
+				relocatorOpts = append(relocatorOpts, webhook.WithStrict())
+			}
+			if pullSecret != "" {
+				source, err := parseNamespacedName(pullSecret)
+				if err != nil {
+					return err
+				}
+				relocatorOpts = append(relocatorOpts, webhook.WithPullSecret(source.Name))
+
+				if err := (&controllers.PullSecretReconciler{
+					Client:             mgr.GetClient(),
+					Source:             source,
+					ExcludedNamespaces: excludedNamespaces,
+				}).SetupWithManager(mgr); err != nil {
+					log.Error(err, "unable to create controller", "controller", "PullSecret")
+					os.Exit(1)
+				}
+			}
+			if len(imageRules) > 0 {
+				rules, err := parseImageRules(imageRules)
+				if err != nil {
+					return err
+				}
+				relocatorOpts = append(relocatorOpts, webhook.WithImageRules(rules...))
+				reconciler.ImageRules = rules
+			}
+			certsReady := setupFinished
+			if enableLeaderElection {
+				// only the leader runs the cert rotator, the other replicas wait for its certs to be mounted
+				certsReady = certsMounted(certsDir, setupFinished)
+			}
+			go initControllers(mgr, log, reconciler, registry, certsReady, relocatorOpts...)
 
 			log.Info("starting manager")
 			if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -144,11 +224,28 @@ func addManager(parent *cobra.Command) {
 			"Enabling this will ensure there is only one active controller manager.")
 	f.BoolVar(&dev, "dev", false, "Toggle development mode (increases logging verbosity).")
 	f.StringVar(&registry, "registry", "", "Registry hostname containing package sources.")
+	f.StringVar(&namespace, "namespace", defaultNamespace, "Namespace the manager is installed in, where its webhook certificate is stored.")
+	f.Int64Var(&cacheSize, "cache-size", pack.DefaultCacheSize, "Maximum size in bytes of the fetched packages and rendered manifests to cache, packages are extracted to --cache-dir.")
+	f.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "Maximum number of Kevis reconciled at once.")
+	f.StringVar(&cacheDir, "cache-dir", os.TempDir(), "Directory fetched package content is extracted to.")
+	f.Int64Var(&maxPackageSize, "max-package-size", 256<<20, "Maximum size in bytes of a package's compressed or extracted content.")
+	f.DurationVar(&driftInterval, "drift-interval", 3*time.Minute, "How often synced Kevis are checked for drift, 0 disables periodic checks.")
+	f.BoolVar(&requireServiceAccount, "require-service-account", false, "Refuse to sync Kevis that don't set spec.serviceAccountName.")
+	f.BoolVar(&allowUnsafeKubeConfigs, "allow-unsafe-kubeconfigs", false, "Allow the kubeconfigs of remote targets to run exec and auth provider plugins, and to read credentials from files in the manager's pod.")
+	f.BoolVar(&relocateImages, "relocate-images", false, "Rewrite images in rendered manifests to the registry before syncing, instead of only at pod admission.")
+	f.StringVar(&relocationStrategy, "relocation-strategy", string(pack.RelocateRepository), "How images are mapped to registry repositories, one of repository, host or hash.")
+	f.BoolVar(&checkImages, "check-images", false, "Only relocate pod images that exist in the registry.")
+	f.DurationVar(&checkImagesTTL, "check-images-ttl", 5*time.Minute, "How long the result of checking an image exists is cached.")
+	f.DurationVar(&checkImagesTimeout, "check-images-timeout", 2*time.Second, "Timeout of checking an image exists in the registry.")
+	f.BoolVar(&denyMissingImages, "deny-missing-images", false, "Deny pods with images that don't exist in the registry, implies --check-images.")
+	f.StringSliceVar(&excludedNamespaces, "excluded-namespaces", webhook.DefaultExcludedNamespaces, "Namespaces whose pods are never relocated.")
+	f.StringVar(&pullSecret, "pull-secret", "", "Pull secret of the registry as namespace/name, added to relocated pods and replicated into their namespaces.")
+	f.StringArrayVar(&imageRules, "image-rule", nil, "Also relocate images in other resources, as resource.group=path[,path...] such as prometheuses.monitoring.coreos.com={.spec.image}.")
 
 	parent.AddCommand(cmd)
 }
 
-func initControllers(mgr ctrl.Manager, log logr.Logger, reconciler *controllers.KeviReconciler, registry string, certsCreated chan struct{}) {
+func initControllers(mgr ctrl.Manager, log logr.Logger, reconciler *controllers.KeviReconciler, registry string, certsCreated chan struct{}, relocatorOpts ...webhook.RelocatorOption) {
 	log.Info("waiting for certificate generation/rotation")
 	<-certsCreated
 	log.Info("certs created")
@@ -159,8 +256,49 @@ func initControllers(mgr ctrl.Manager, log logr.Logger, reconciler *controllers.
 		os.Exit(1)
 	}
 
-	if err := webhook.AddPodRelocatorToManager(mgr, registry); err != nil {
+	// the webhook and render time relocation share the reconciler's strategy, so both rewrite images identically
+	if err := webhook.AddPodRelocatorToManager(mgr, registry, reconciler.RelocationStrategy, relocatorOpts...); err != nil {
 		log.Error(err, "failed to register pod relocator webhook")
 		os.Exit(1)
 	}
 }
+
+// certsMounted returns a channel closed once the rotator's certs are ready, or once they're found in certsDir
+func certsMounted(certsDir string, ready chan struct{}) chan struct{} {
+	mounted := make(chan struct{})
+	go func() {
+		defer close(mounted)
+		for {
+			select {
+			case <-ready:
+				return
+			case <-time.After(time.Second):
+			}
+			if _, err := os.Stat(filepath.Join(certsDir, "tls.crt")); err == nil {
+				return
+			}
+		}
+	}()
+	return mounted
+}
+
+// parseNamespacedName parses a namespace/name reference
+func parseNamespacedName(s string) (types.NamespacedName, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q must be formatted as namespace/name", s)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+func parseImageRules(rules []string) ([]webhook.ImageRule, error) {
+	var parsed []webhook.ImageRule
+	for _, r := range rules {
+		rule, err := webhook.ParseImageRule(r)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+
+	"cattle.io/kevi/pkg/fetcher"
+	"cattle.io/kevi/pkg/mirrors"
+	"cattle.io/kevi/pkg/pack"
+	"cattle.io/kevi/pkg/webhook"
+)
+
+func addMirrors(parent *cobra.Command) {
+	var (
+		storePath          string
+		relocationsPath    string
+		relocationStrategy string
+		output             string
+
+		username  string
+		password  string
+		insecure  bool
+		plainHttp bool
+		caFile    string
+		certFile  string
+		keyFile   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "mirrors",
+		Short: "generate containerd and k3s registry mirror configuration for a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+			registry := args[0]
+
+			var images []string
+			strategy, err := pack.ParseRelocationStrategy(relocationStrategy)
+			if err != nil {
+				return err
+			}
+
+			if relocationsPath != "" {
+				l.Info().Msgf("Loading relocations [%s]", relocationsPath)
+				data, err := os.ReadFile(relocationsPath)
+				if err != nil {
+					return err
+				}
+
+				var relocations []webhook.Relocation
+				if err := json.Unmarshal(data, &relocations); err != nil {
+					return err
+				}
+				for _, r := range relocations {
+					images = append(images, r.Source)
+				}
+			} else {
+				l.Info().Msgf("Loading store [%s]", storePath)
+				s, err := pack.NewOci(storePath)
+				if err != nil {
+					return err
+				}
+
+				strategy, err = storeRelocationStrategy(ctx, s, relocationStrategy)
+				if err != nil {
+					return err
+				}
+
+				if err := s.Walk(func(reference string, desc ocispec.Descriptor) error {
+					// kevi's own packages are fetched from the registry directly, not through a mirror
+					if !strings.HasPrefix(reference, fetcher.DefaultRepositoryNamespace+"/") {
+						images = append(images, reference)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+
+			sources, err := mirrors.Sources(images, registry)
+			if err != nil {
+				return err
+			}
+
+			opts := mirrors.Options{
+				Registry:  registry,
+				Strategy:  strategy,
+				Username:  username,
+				Password:  password,
+				PlainHTTP: plainHttp,
+				Insecure:  insecure,
+				CAFile:    caFile,
+				CertFile:  certFile,
+				KeyFile:   keyFile,
+			}
+			if err := mirrors.Write(output, sources, opts); err != nil {
+				return err
+			}
+
+			for _, s := range sources {
+				l.Info().Msgf("Mirrored [%s] to [%s] with the [%s] strategy", s, registry, strategy)
+			}
+			l.Info().Msgf("Wrote mirror configuration to [%s]", output)
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&storePath, "store", "s", "./store", "Path to store.")
+	f.StringVar(&relocationsPath, "relocations", "", "Path to the JSON of the manager's /relocations endpoint, used instead of the store.")
+	f.StringVar(&relocationStrategy, "relocation-strategy", "", "How images are mapped to registry repositories, one of repository, host or hash. Defaults to the strategy the store was packed with.")
+	f.StringVarP(&output, "output", "o", "./mirrors", "Directory the certs.d hosts.toml files and registries.yaml are written to.")
+	f.StringVarP(&username, "username", "u", "", "Username of the registry.")
+	f.StringVarP(&password, "password", "p", "", "Password of the registry.")
+	f.BoolVar(&insecure, "insecure", false, "Skip verifying the registry's certificate.")
+	f.BoolVar(&plainHttp, "plain-http", false, "Pull from the registry over http.")
+	f.StringVar(&caFile, "ca-file", "", "Path on the nodes of the registry's CA certificate.")
+	f.StringVar(&certFile, "cert-file", "", "Path on the nodes of a client certificate for the registry.")
+	f.StringVar(&keyFile, "key-file", "", "Path on the nodes of the client certificate's key.")
+
+	parent.AddCommand(cmd)
+}
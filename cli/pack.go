@@ -23,6 +23,9 @@ func addPack(parent *cobra.Command) {
 		packages    []string
 		archive     bool
 		archivePath string
+
+		relocationStrategy string
+		controllerBinaries map[string]string
 	)
 
 	cmd := &cobra.Command{
@@ -38,6 +41,11 @@ func addPack(parent *cobra.Command) {
 
 			ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+			strategy, err := pack.ParseRelocationStrategy(relocationStrategy)
+			if err != nil {
+				return err
+			}
+
 			s, err := pack.NewOci(store)
 			if err != nil {
 				return err
@@ -70,6 +78,14 @@ func addPack(parent *cobra.Command) {
 						return err
 					}
 
+					// record the strategy so relocating and deploying the store map images the same way
+					annotations := k.GetAnnotations()
+					if annotations == nil {
+						annotations = make(map[string]string)
+					}
+					annotations[pack.RelocationStrategyAnnotation] = string(strategy)
+					k.SetAnnotations(annotations)
+
 					l.Info().Msgf("Packaging [%s]", k.Name)
 					descs, err := s.Pack(ctx, k)
 					if err != nil {
@@ -82,6 +98,18 @@ func addPack(parent *cobra.Command) {
 				}
 			}
 
+			for platform, path := range controllerBinaries {
+				abs, err := filepath.Abs(path)
+				if err != nil {
+					return err
+				}
+
+				l.Info().Msgf("Packaging controller binary [%s] for [%s]", path, platform)
+				if _, err := s.AddControllerBinary(ctx, platform, abs); err != nil {
+					return err
+				}
+			}
+
 			if archive {
 				cwd, err := os.Getwd()
 				if err != nil {
@@ -107,6 +135,8 @@ func addPack(parent *cobra.Command) {
 	f.StringSliceVarP(&packages, "package", "f", []string{}, "Paths to package files, can be specified multiple times.")
 	f.BoolVarP(&archive, "archive", "a", false, "Toggle archiving the store after processing all packages.")
 	f.StringVar(&archivePath, "archive-path", "packages.tar.gz", "Path to output archive to, only used when --archive is true")
+	f.StringVar(&relocationStrategy, "relocation-strategy", string(pack.RelocateRepository), "How images are mapped to registry repositories when the store is relocated, one of repository, host or hash.")
+	f.StringToStringVar(&controllerBinaries, "controller-binary", nil, "Kevi binaries for other platforms as os/arch=path, assembled into a multi-arch controller image when deployed.")
 
 	parent.AddCommand(cmd)
 }
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"cattle.io/kevi/api/v1alpha1"
+)
+
+func addRollback(parent *cobra.Command) {
+	var (
+		namespace string
+		revision  int64
+		resume    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rollback NAME",
+		Short: "roll a kevi's packages back to a revision recorded in its history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+
+			c, err := kubeClient()
+			if err != nil {
+				return err
+			}
+
+			var kevi v1alpha1.Kevi
+			if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: args[0]}, &kevi); err != nil {
+				return err
+			}
+
+			if !resume && revision == 0 {
+				fmt.Printf("History of %s/%s\n", namespace, args[0])
+				for _, entry := range kevi.Status.History {
+					fmt.Printf("  %d\t%s\t%s\t%s\n", entry.ID, entry.SyncedAt.Format("2006-01-02T15:04:05Z07:00"), entry.Result, entry.Message)
+				}
+				return nil
+			}
+
+			patch := client.MergeFrom(kevi.DeepCopy())
+			if resume {
+				kevi.Spec.RollbackTo = nil
+			} else {
+				if kevi.Status.Revision(revision) == nil {
+					return fmt.Errorf("revision %d isn't recorded in the history of %s/%s", revision, namespace, args[0])
+				}
+				kevi.Spec.RollbackTo = &revision
+			}
+
+			if err := c.Patch(ctx, &kevi, patch); err != nil {
+				return err
+			}
+
+			if resume {
+				l.Info().Msgf("Resumed syncing the current revisions of [%s/%s]", namespace, args[0])
+			} else {
+				l.Info().Msgf("Rolling [%s/%s] back to revision [%d]", namespace, args[0], revision)
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&namespace, "namespace", "n", "default", "Namespace of the kevi.")
+	f.Int64Var(&revision, "revision", 0, "History revision to roll back to, lists the history when unset.")
+	f.BoolVar(&resume, "resume", false, "Clear a previous rollback and resume syncing the packages' current revisions.")
+
+	parent.AddCommand(cmd)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/controllers"
+)
+
+func addSync(parent *cobra.Command) {
+	var namespace string
+
+	cmd := &cobra.Command{
+		Use:   "sync NAME",
+		Short: "request an immediate sync of a kevi",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+
+			c, err := kubeClient()
+			if err != nil {
+				return err
+			}
+
+			var kevi v1alpha1.Kevi
+			if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: args[0]}, &kevi); err != nil {
+				return err
+			}
+
+			requested := time.Now().UTC().Format(time.RFC3339Nano)
+			patch := client.MergeFrom(kevi.DeepCopy())
+			annotations := kevi.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[controllers.ReconcileRequestedAtAnnotation] = requested
+			kevi.SetAnnotations(annotations)
+
+			if err := c.Patch(ctx, &kevi, patch); err != nil {
+				return err
+			}
+
+			if kevi.Spec.Suspend {
+				l.Warn().Msgf("Kevi [%s/%s] is suspended, the sync will run once it's resumed", namespace, args[0])
+			}
+			l.Info().Msgf("Requested sync of [%s/%s] at [%s]", namespace, args[0], requested)
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&namespace, "namespace", "n", "default", "Namespace of the kevi.")
+
+	parent.AddCommand(cmd)
+}
+
+func kubeClient() (client.Client, error) {
+	return client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/controllers"
+	"cattle.io/kevi/pkg/install"
+)
+
+func addUninstall(parent *cobra.Command) {
+	var (
+		namespace     string
+		keepWorkloads bool
+		dryRun        bool
+		timeout       time.Duration
+		allowUnsafe   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "remove kevi, and the resources of its kevis, from a cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l := plog()
+			ctx := cmd.Context()
+
+			l.Info().Msgf("Setting up connection to cluster")
+			cfg := ctrl.GetConfigOrDie()
+			rmgr, err := controllers.NewResourceManager(cfg)
+			if err != nil {
+				return err
+			}
+
+			if !keepWorkloads {
+				if err := uninstallKevis(ctx, cfg, rmgr, timeout, dryRun, allowUnsafe); err != nil {
+					return err
+				}
+			}
+
+			objs, err := install.UninstallObjects(ctx, rmgr.Client(), namespace)
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				if !keepWorkloads {
+					replicas, err := install.PullSecretReplicas(ctx, rmgr.Client())
+					if err != nil {
+						return err
+					}
+					objs = append(objs, replicas...)
+				}
+				for _, obj := range objs {
+					fmt.Printf("%s would be deleted\n", ssa.FmtUnstructured(obj))
+				}
+				return nil
+			}
+
+			l.Info().Msgf("Uninstalling kevi from namespace [%s]", namespace)
+			cs, err := rmgr.DeleteAll(ctx, objs, ssa.DefaultDeleteOptions())
+			if err != nil {
+				return err
+			}
+			fmt.Println(cs.String())
+
+			l.Info().Msgf("Waiting for kevi to be removed")
+			if err := rmgr.WaitForTermination(objs, ssa.WaitOptions{Interval: 2 * time.Second, Timeout: timeout}); err != nil {
+				return err
+			}
+			// kept workloads go on pulling their relocated images with the pull secret's replicas
+			if keepWorkloads {
+				return nil
+			}
+
+			// replicas are only found once the manager is gone, so it can't replicate them again
+			replicas, err := install.PullSecretReplicas(ctx, rmgr.Client())
+			if err != nil || len(replicas) == 0 {
+				return err
+			}
+			l.Info().Msgf("Deleting [%d] pull secret replicas", len(replicas))
+			cs, err = rmgr.DeleteAll(ctx, replicas, ssa.DefaultDeleteOptions())
+			if err != nil {
+				return err
+			}
+			fmt.Println(cs.String())
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&namespace, "namespace", "n", defaultNamespace, "Namespace kevi is installed in.")
+	f.BoolVar(&keepWorkloads, "keep-workloads", false, "Leave the kevis' resources running, along with the pull secret replicas they pull with, only removing kevi itself.")
+	f.BoolVar(&dryRun, "dry-run", false, "Print what would be deleted without deleting anything.")
+	f.BoolVar(&allowUnsafe, "allow-unsafe-kubeconfigs", false, "Allow the kubeconfigs of the kevis' remote targets to run exec and auth provider plugins, and to read local files.")
+	f.DurationVar(&timeout, "timeout", 5*time.Minute, "How long to wait for each set of deleted resources to be removed.")
+
+	parent.AddCommand(cmd)
+}
+
+// keviCluster is a cluster kevis are synced to, and the resources synced to it
+type keviCluster struct {
+	config    *rest.Config
+	resources []*unstructured.Unstructured
+}
+
+// uninstallKevis deletes every kevi and then the resources synced from its packages, so the controller can't sync them
+// again while they're torn down. Resources synced to remote targets are deleted from the target.
+func uninstallKevis(ctx context.Context, cfg *rest.Config, rmgr *ssa.ResourceManager, timeout time.Duration, dryRun bool, allowUnsafe bool) error {
+	l := plog()
+	c := rmgr.Client()
+
+	var list v1alpha1.KeviList
+	if err := c.List(ctx, &list); err != nil {
+		// there's nothing to tear down once the CRD is gone
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	var kevis []*unstructured.Unstructured
+	clusters := make(map[string]*keviCluster)
+	targets := make(map[string][]*v1alpha1.Kevi)
+	for i := range list.Items {
+		kevi := &list.Items[i]
+
+		name, tcfg, err := keviTarget(ctx, c, cfg, kevi, allowUnsafe)
+		if err != nil {
+			return err
+		}
+		if _, ok := clusters[name]; !ok {
+			clusters[name] = &keviCluster{config: tcfg}
+		}
+		targets[name] = append(targets[name], kevi)
+
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(kevi)
+		if err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{Object: u}
+		obj.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("Kevi"))
+		kevis = append(kevis, obj)
+	}
+
+	for name, tc := range clusters {
+		l.Info().Msgf("Finding the resources of kevis synced to [%s]", name)
+		cc := controllers.NewClusterCache(tc.config)
+		if err := cc.EnsureSynced(); err != nil {
+			return fmt.Errorf("syncing cache of %s: %w", name, err)
+		}
+		for _, kevi := range targets[name] {
+			tc.resources = append(tc.resources, controllers.ManagedResources(cc, kevi)...)
+		}
+		cc.Invalidate()
+	}
+
+	if dryRun {
+		for _, obj := range kevis {
+			fmt.Printf("%s would be deleted\n", ssa.FmtUnstructured(obj))
+		}
+		for name, tc := range clusters {
+			for _, obj := range tc.resources {
+				fmt.Printf("%s would be deleted from [%s]\n", ssa.FmtUnstructured(obj), name)
+			}
+		}
+		return nil
+	}
+
+	l.Info().Msgf("Deleting [%d] kevis", len(kevis))
+	cs, err := rmgr.DeleteAll(ctx, kevis, ssa.DefaultDeleteOptions())
+	if err != nil {
+		return err
+	}
+	fmt.Println(cs.String())
+	if err := rmgr.WaitForTermination(kevis, ssa.WaitOptions{Interval: 2 * time.Second, Timeout: timeout}); err != nil {
+		return err
+	}
+
+	// foreground deletion waits on the objects the resources own too, such as a deployment's pods
+	opts := ssa.DefaultDeleteOptions()
+	opts.PropagationPolicy = metav1.DeletePropagationForeground
+
+	for name, tc := range clusters {
+		trmgr := rmgr
+		if tc.config != cfg {
+			if trmgr, err = controllers.NewResourceManager(tc.config); err != nil {
+				return err
+			}
+		}
+
+		l.Info().Msgf("Deleting [%d] resources from [%s]", len(tc.resources), name)
+		cs, err := trmgr.DeleteAll(ctx, tc.resources, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(cs.String())
+
+		l.Info().Msgf("Waiting for the resources to be removed from [%s]", name)
+		if err := trmgr.WaitForTermination(tc.resources, ssa.WaitOptions{Interval: 2 * time.Second, Timeout: timeout}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keviTarget returns the name and config of the cluster a kevi's packages are synced to, refusing kubeconfigs that run
+// plugins or read local files unless allowUnsafe is set
+func keviTarget(ctx context.Context, c client.Reader, cfg *rest.Config, kevi *v1alpha1.Kevi, allowUnsafe bool) (string, *rest.Config, error) {
+	if kevi.Spec.Target == nil {
+		return "in-cluster", cfg, nil
+	}
+
+	name := kevi.Namespace + "/" + kevi.Spec.Target.KubeConfigSecretRef.Name
+	kubeconfig, err := controllers.TargetKubeConfig(ctx, c, kevi)
+	if err != nil {
+		return "", nil, err
+	}
+	tcfg, err := controllers.TargetRESTConfig(kubeconfig, allowUnsafe)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing kubeconfig of %s: %w", name, err)
+	}
+	return name, tcfg, nil
+}
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	gosync "sync"
+
+	"github.com/argoproj/gitops-engine/pkg/cache"
+	"github.com/argoproj/gitops-engine/pkg/engine"
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+const (
+	// DefaultKubeConfigKey is the key a target's kubeconfig is read from when its secret reference doesn't set one
+	DefaultKubeConfigKey = "kubeconfig"
+
+	// inCluster names the controller's own cluster in Kevi statuses
+	inCluster = "in-cluster"
+)
+
+// targetCluster is a cluster Kevis are synced to, along with the gitops-engine cache and engine kept for it
+type targetCluster struct {
+	name string
+
+	// hash identifies the kubeconfig a remote cluster was connected with
+	hash string
+
+	config    *rest.Config
+	cache     cache.ClusterCache
+	engine    engine.GitOpsEngine
+	resources *ssa.ResourceManager
+
+	// syncers are the cluster's impersonating syncers, by username
+	syncers map[string]syncer
+}
+
+// PopulateResourceInfo records the gc mark of every resource in a gitops-engine cluster cache
+func PopulateResourceInfo(un *unstructured.Unstructured, isRoot bool) (info interface{}, cacheManifest bool) {
+	gcMark := un.GetAnnotations()[GCAnnotationMark]
+	info = &GCMark{Mark: gcMark}
+	// cache resources that has that mark to improve performance
+	cacheManifest = gcMark != ""
+	return
+}
+
+// NewClusterCache returns a gitops-engine cluster cache of the cluster at cfg, tracking the resources kevi manages
+func NewClusterCache(cfg *rest.Config, opts ...cache.UpdateSettingsFunc) cache.ClusterCache {
+	opts = append([]cache.UpdateSettingsFunc{cache.SetPopulateResourceInfoHandler(PopulateResourceInfo)}, opts...)
+	return cache.NewClusterCache(cfg, opts...)
+}
+
+// ManagedResources returns the resources in a synced cluster cache that were synced from any of a Kevi's packages
+func ManagedResources(cc cache.ClusterCache, kevi *packagesv1alpha1.Kevi) []*unstructured.Unstructured {
+	var objs []*unstructured.Unstructured
+	for _, r := range cc.FindResources("", isManagedBy(kevi)) {
+		if r.Resource != nil {
+			objs = append(objs, r.Resource)
+		}
+	}
+	return objs
+}
+
+func isManagedBy(kevi *packagesv1alpha1.Kevi) func(r *cache.Resource) bool {
+	prefix := kevi.Namespace + "/" + kevi.Name + "/"
+	return func(r *cache.Resource) bool {
+		if r.Info != nil {
+			return strings.HasPrefix(r.Info.(*GCMark).Mark, prefix)
+		}
+		return false
+	}
+}
+
+// TargetKubeConfig returns the kubeconfig of the remote cluster a Kevi targets
+func TargetKubeConfig(ctx context.Context, c client.Reader, kevi *packagesv1alpha1.Kevi) ([]byte, error) {
+	ref := kevi.Spec.Target.KubeConfigSecretRef
+	key := ref.Key
+	if key == "" {
+		key = DefaultKubeConfigKey
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: kevi.Namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, err
+	}
+	kubeconfig, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", targetName(kevi), key)
+	}
+	return kubeconfig, nil
+}
+
+// TargetRESTConfig parses a target's kubeconfig. Kubeconfigs are written by Kevi authors but used by the controller,
+// so unless allowUnsafe is set they may not run exec or auth provider plugins, or read credentials and CAs from files,
+// which would run commands in the controller's pod or send its own service account token to the target.
+func TargetRESTConfig(kubeconfig []byte, allowUnsafe bool) (*rest.Config, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	if !allowUnsafe {
+		if err := validateKubeConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// validateKubeConfig refuses kubeconfigs that run plugins or read files
+func validateKubeConfig(config *clientcmdapi.Config) error {
+	for name, auth := range config.AuthInfos {
+		switch {
+		case auth.Exec != nil:
+			return fmt.Errorf("user %s uses an exec plugin, which isn't allowed", name)
+		case auth.AuthProvider != nil:
+			return fmt.Errorf("user %s uses an auth provider, which isn't allowed", name)
+		case auth.TokenFile != "":
+			return fmt.Errorf("user %s reads its token from a file, which isn't allowed", name)
+		case auth.ClientCertificate != "" || auth.ClientKey != "":
+			return fmt.Errorf("user %s reads its client certificate from a file, which isn't allowed", name)
+		}
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return fmt.Errorf("cluster %s reads its certificate authority from a file, which isn't allowed", name)
+		}
+	}
+	return nil
+}
+
+// clusterFor returns the cluster a Kevi's packages are synced to, connecting to and caching a remote target the first
+// time it's used, and again whenever its kubeconfig changes
+func (r *KeviReconciler) clusterFor(ctx context.Context, kevi *packagesv1alpha1.Kevi) (*targetCluster, error) {
+	if kevi.Spec.Target == nil {
+		r.clustersMu.Lock()
+		defer r.clustersMu.Unlock()
+		if r.local == nil {
+			r.local = &targetCluster{
+				name:      inCluster,
+				config:    r.Config,
+				cache:     r.ClusterCache,
+				engine:    r.Engine,
+				resources: r.ResourceManager,
+			}
+		}
+		return r.local, nil
+	}
+
+	name := targetName(kevi)
+	kubeconfig, err := TargetKubeConfig(ctx, r, kevi)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(kubeconfig)
+	hash := hex.EncodeToString(h[:])
+
+	// connecting to a target holds only the target's lock, so an unreachable target never stalls other Kevis
+	lock := r.targetLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	r.clustersMu.Lock()
+	old, ok := r.clusters[name]
+	r.clustersMu.Unlock()
+	if ok && old.hash == hash {
+		return old, nil
+	}
+
+	cfg, err := TargetRESTConfig(kubeconfig, r.AllowUnsafeKubeConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig of %s: %w", name, err)
+	}
+
+	cc := NewClusterCache(cfg, cache.SetLogr(ctrl.Log.WithName("cluster").WithValues("cluster", name)))
+	if err := cc.EnsureSynced(); err != nil {
+		cc.Invalidate()
+		return nil, fmt.Errorf("syncing cache of %s: %w", name, err)
+	}
+
+	rm, err := NewResourceManager(cfg)
+	if err != nil {
+		cc.Invalidate()
+		return nil, err
+	}
+
+	tc := &targetCluster{
+		name:      name,
+		hash:      hash,
+		config:    cfg,
+		cache:     cc,
+		engine:    engine.NewEngine(cfg, cc),
+		resources: rm,
+	}
+
+	r.clustersMu.Lock()
+	if r.clusters == nil {
+		r.clusters = make(map[string]*targetCluster)
+	}
+	r.clusters[name] = tc
+	r.clustersMu.Unlock()
+
+	// the cache of a changed kubeconfig is only dropped once its replacement is synced
+	if ok {
+		old.cache.Invalidate()
+	}
+	return tc, nil
+}
+
+// targetLock returns the lock held while connecting to the named target
+func (r *KeviReconciler) targetLock(name string) *gosync.Mutex {
+	r.clustersMu.Lock()
+	defer r.clustersMu.Unlock()
+
+	if r.targetLocks == nil {
+		r.targetLocks = make(map[string]*gosync.Mutex)
+	}
+	lock, ok := r.targetLocks[name]
+	if !ok {
+		lock = &gosync.Mutex{}
+		r.targetLocks[name] = lock
+	}
+	return lock
+}
+
+// targetName names the cluster a Kevi targets in its status
+func targetName(kevi *packagesv1alpha1.Kevi) string {
+	if kevi.Spec.Target == nil {
+		return inCluster
+	}
+	return kevi.Namespace + "/" + kevi.Spec.Target.KubeConfigSecretRef.Name
+}
+
+// clusterStatus reports the state of a cluster's cache
+func clusterStatus(tc *targetCluster) *packagesv1alpha1.KeviClusterStatus {
+	status := &packagesv1alpha1.KeviClusterStatus{Name: tc.name}
+	if tc.cache == nil {
+		return status
+	}
+
+	info := tc.cache.GetClusterInfo()
+	status.Server = info.Server
+	status.KubernetesVersion = info.K8SVersion
+	status.ResourcesCount = info.ResourcesCount
+	if info.LastCacheSyncTime != nil {
+		t := metav1.NewTime(*info.LastCacheSyncTime)
+		status.LastCacheSyncTime = &t
+	}
+	if info.SyncError != nil {
+		status.Message = info.SyncError.Error()
+	}
+	return status
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argoproj/gitops-engine/pkg/cache"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+var _ = Describe("Remote targets", func() {
+	It("syncs to the cluster of a kubeconfig secret instead of the local cluster", func() {
+		ctx := context.Background()
+
+		user, err := remoteEnv.AddUser(envtest.User{Name: "kevi", Groups: []string{"system:masters"}}, remoteCfg)
+		Expect(err).NotTo(HaveOccurred())
+		kubeconfig, err := user.KubeConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: "default"},
+			Data:       map[string][]byte{DefaultKubeConfigKey: kubeconfig},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+		kevi := &packagesv1alpha1.Kevi{
+			ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: "default"},
+			Spec: packagesv1alpha1.KeviSpec{
+				Target: &packagesv1alpha1.KeviTarget{
+					KubeConfigSecretRef: packagesv1alpha1.KeviSecretKeyRef{Name: "remote"},
+				},
+			},
+		}
+
+		r := &KeviReconciler{Client: k8sClient}
+		tc, err := r.clusterFor(ctx, kevi)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterStatus(tc).Name).To(Equal("default/remote"))
+		Expect(clusterStatus(tc).Server).To(Equal(user.Config().Host))
+
+		again, err := r.clusterFor(ctx, kevi)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(tc))
+
+		s, err := r.syncerFor(kevi, tc)
+		Expect(err).NotTo(HaveOccurred())
+
+		mark := gcMark(kevi, packagesv1alpha1.KeviSpecPackage{Name: "pkg"})
+		cm := &unstructured.Unstructured{}
+		cm.SetAPIVersion("v1")
+		cm.SetKind("ConfigMap")
+		cm.SetName("kevi-remote")
+		cm.SetNamespace("default")
+		cm.SetAnnotations(map[string]string{GCAnnotationMark: mark})
+
+		_, err = r.sync(ctx, s, []*unstructured.Unstructured{cm}, mark, packagesv1alpha1.KeviSpecPackageSyncOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		remoteClient, err := client.New(remoteCfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+
+		key := types.NamespacedName{Name: "kevi-remote", Namespace: "default"}
+		Eventually(func() error {
+			return remoteClient.Get(ctx, key, &corev1.ConfigMap{})
+		}, 10*time.Second).Should(Succeed())
+
+		err = k8sClient.Get(ctx, key, &corev1.ConfigMap{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+func TestIsManagedBy(t *testing.T) {
+	kevi := &packagesv1alpha1.Kevi{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+
+	tests := []struct {
+		name string
+		info interface{}
+		want bool
+	}{
+		{name: "package of the kevi", info: &GCMark{Mark: "default/app/pkg"}, want: true},
+		{name: "kevi sharing a name prefix", info: &GCMark{Mark: "default/app-two/pkg"}},
+		{name: "kevi in another namespace", info: &GCMark{Mark: "other/app/pkg"}},
+		{name: "unmanaged", info: &GCMark{}},
+		{name: "no info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isManagedBy(kevi)(&cache.Resource{Info: tt.info}); got != tt.want {
+				t.Errorf("isManagedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetRESTConfig(t *testing.T) {
+	kubeconfig := func(user string, cluster string) []byte {
+		return []byte(`apiVersion: v1
+kind: Config
+current-context: target
+contexts:
+- name: target
+  context: {cluster: target, user: target}
+clusters:
+- name: target
+  cluster:
+    server: https://target.example.com
+` + cluster + `
+users:
+- name: target
+  user:
+` + user)
+	}
+
+	tests := []struct {
+		name        string
+		kubeconfig  []byte
+		allowUnsafe bool
+		wantErr     bool
+	}{
+		{name: "token", kubeconfig: kubeconfig("    token: abc", "")},
+		{name: "exec plugin", kubeconfig: kubeconfig("    exec: {apiVersion: client.authentication.k8s.io/v1beta1, command: sh}", ""), wantErr: true},
+		{name: "auth provider", kubeconfig: kubeconfig("    auth-provider: {name: gcp}", ""), wantErr: true},
+		{name: "token file", kubeconfig: kubeconfig("    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token", ""), wantErr: true},
+		{name: "client key file", kubeconfig: kubeconfig("    client-key: /etc/key.pem", ""), wantErr: true},
+		{name: "certificate authority file", kubeconfig: kubeconfig("    token: abc", "    certificate-authority: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt"), wantErr: true},
+		{name: "exec plugin allowed", kubeconfig: kubeconfig("    exec: {apiVersion: client.authentication.k8s.io/v1beta1, command: sh}", ""), allowUnsafe: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := TargetRESTConfig(tt.kubeconfig, tt.allowUnsafe)
+			if (err != nil) != tt.wantErr || (err != nil && !strings.Contains(err.Error(), "isn't allowed")) {
+				t.Fatalf("TargetRESTConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Host != "https://target.example.com" {
+				t.Errorf("TargetRESTConfig() host = %s, want the target's server", cfg.Host)
+			}
+		})
+	}
+}
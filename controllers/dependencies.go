@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"fmt"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+// packageLevels groups packages into levels using their dependsOn graph, every package in a level only depends on
+// packages in earlier levels, so packages within the same level can be processed concurrently
+func packageLevels(pkgs []packagesv1alpha1.KeviSpecPackage) ([][]packagesv1alpha1.KeviSpecPackage, error) {
+	byName := make(map[string]packagesv1alpha1.KeviSpecPackage, len(pkgs))
+	for _, pkg := range pkgs {
+		if _, ok := byName[pkg.Name]; ok {
+			return nil, fmt.Errorf("duplicate package name %q", pkg.Name)
+		}
+		byName[pkg.Name] = pkg
+	}
+
+	remaining := make(map[string]int, len(pkgs))
+	dependents := make(map[string][]string)
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("package %q depends on unknown package %q", pkg.Name, dep)
+			}
+			dependents[dep] = append(dependents[dep], pkg.Name)
+		}
+		remaining[pkg.Name] = len(pkg.DependsOn)
+	}
+
+	var (
+		levels    [][]packagesv1alpha1.KeviSpecPackage
+		processed int
+	)
+	for processed < len(pkgs) {
+		// preserve the spec ordering within a level
+		var level []packagesv1alpha1.KeviSpecPackage
+		for _, pkg := range pkgs {
+			if n, ok := remaining[pkg.Name]; ok && n == 0 {
+				level = append(level, pkg)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("packages contain a dependency cycle")
+		}
+
+		for _, pkg := range level {
+			delete(remaining, pkg.Name)
+			for _, d := range dependents[pkg.Name] {
+				remaining[d]--
+			}
+		}
+
+		processed += len(level)
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestPackageLevels(t *testing.T) {
+	pkg := func(name string, deps ...string) packagesv1alpha1.KeviSpecPackage {
+		return packagesv1alpha1.KeviSpecPackage{Name: name, DependsOn: deps}
+	}
+
+	tests := []struct {
+		name    string
+		pkgs    []packagesv1alpha1.KeviSpecPackage
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "independent packages share a level",
+			pkgs: []packagesv1alpha1.KeviSpecPackage{pkg("a"), pkg("b"), pkg("c")},
+			want: [][]string{{"a", "b", "c"}},
+		},
+		{
+			name: "dependencies are ordered",
+			pkgs: []packagesv1alpha1.KeviSpecPackage{pkg("app", "crds", "db"), pkg("db", "crds"), pkg("crds"), pkg("other")},
+			want: [][]string{{"crds", "other"}, {"db"}, {"app"}},
+		},
+		{
+			name:    "unknown dependency",
+			pkgs:    []packagesv1alpha1.KeviSpecPackage{pkg("a", "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "cycle",
+			pkgs:    []packagesv1alpha1.KeviSpecPackage{pkg("a", "b"), pkg("b", "a")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, err := packageLevels(tt.pkgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("packageLevels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got [][]string
+			for _, l := range levels {
+				var names []string
+				for _, p := range l {
+					names = append(names, p.Name)
+				}
+				got = append(got, names)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("packageLevels() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
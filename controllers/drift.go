@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/argoproj/gitops-engine/pkg/cache"
+	"github.com/argoproj/gitops-engine/pkg/diff"
+	"github.com/argoproj/gitops-engine/pkg/sync"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+// drift compares a package's rendered objects with their live state in the cluster cache, returning every resource
+// that is modified, missing, or no longer rendered but still marked as managed, excluding any ignored fields
+func (r *KeviReconciler) drift(ctx context.Context, cc cache.ClusterCache, objs []*unstructured.Unstructured, mark string, rules []ignoreRule) ([]packagesv1alpha1.KeviResourceStatus, error) {
+	result, diffs, err := r.compare(ctx, cc, objs, mark, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifted []packagesv1alpha1.KeviResourceStatus
+	for i, d := range diffs.Diffs {
+		if !d.Modified {
+			continue
+		}
+
+		obj := result.Target[i]
+		if obj == nil {
+			obj = result.Live[i]
+		}
+		drifted = append(drifted, resourceStatus(obj))
+	}
+	return drifted, nil
+}
+
+// compare pairs a package's rendered objects with their live state and diffs each pair, excluding any ignored fields
+func (r *KeviReconciler) compare(ctx context.Context, cc cache.ClusterCache, objs []*unstructured.Unstructured, mark string, rules []ignoreRule) (sync.ReconciliationResult, *diff.DiffResultList, error) {
+	live, err := cc.GetManagedLiveObjs(objs, isManaged(mark))
+	if err != nil {
+		return sync.ReconciliationResult{}, nil, err
+	}
+
+	result := sync.Reconcile(objs, live, syncNamespace, cc)
+	diffs, err := diff.DiffArray(result.Target, result.Live,
+		diff.WithNormalizer(normalizers{&ignoreNormalizer{rules: rules}, &relocationNormalizer{paths: r.imageRulePaths}}),
+		diff.WithLogr(log.FromContext(ctx)))
+	if err != nil {
+		return sync.ReconciliationResult{}, nil, err
+	}
+	return result, diffs, nil
+}
+
+func resourceStatus(obj *unstructured.Unstructured) packagesv1alpha1.KeviResourceStatus {
+	gvk := obj.GroupVersionKind()
+	return packagesv1alpha1.KeviResourceStatus{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/cache/mocks"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newConfigMap(name string, data map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+		},
+		"data": data,
+	}}
+}
+
+func TestKeviReconciler_drift(t *testing.T) {
+	target := newConfigMap("cm", map[string]interface{}{"key": "value"})
+
+	tests := []struct {
+		name string
+		live *unstructured.Unstructured
+		want int
+	}{
+		{
+			name: "in sync",
+			live: newConfigMap("cm", map[string]interface{}{"key": "value"}),
+			want: 0,
+		},
+		{
+			name: "modified",
+			live: newConfigMap("cm", map[string]interface{}{"key": "edited"}),
+			want: 1,
+		},
+		{
+			name: "missing",
+			live: nil,
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := make(map[kube.ResourceKey]*unstructured.Unstructured)
+			if tt.live != nil {
+				live[kube.GetResourceKey(tt.live)] = tt.live
+			}
+
+			cc := &mocks.ClusterCache{}
+			cc.On("GetManagedLiveObjs", mock.Anything, mock.Anything).Return(live, nil)
+			cc.On("IsNamespaced", mock.Anything).Return(true, nil)
+
+			r := &KeviReconciler{}
+			got, err := r.drift(context.Background(), cc, []*unstructured.Unstructured{target.DeepCopy()}, "default/kevi/pkg", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("drift() got %d drifted resources, want %d: %v", len(got), tt.want, got)
+			}
+		})
+	}
+}
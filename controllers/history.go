@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+// defaultRevisionHistoryLimit is the number of history entries kept when a Kevi doesn't set a limit
+const defaultRevisionHistoryLimit = 10
+
+// recordHistory appends an entry for a sync of the attempted packages, the entry records every package's revision,
+// using the last synced revision of packages that weren't attempted
+func recordHistory(kevi *packagesv1alpha1.Kevi, statuses map[string]packagesv1alpha1.KeviPackageStatus, attempted map[string]packagesv1alpha1.KeviPackageRevision, syncErr error, message string) {
+	entry := packagesv1alpha1.KeviRevisionHistory{
+		SyncedAt: metav1.Now(),
+		Result:   packagesv1alpha1.KeviRevisionSucceeded,
+		Message:  message,
+	}
+	if syncErr != nil {
+		entry.Result = packagesv1alpha1.KeviRevisionFailed
+		entry.Message = syncErr.Error()
+	}
+
+	for _, pkg := range kevi.Spec.Packages {
+		if rev, ok := attempted[pkg.Name]; ok {
+			entry.Packages = append(entry.Packages, rev)
+			continue
+		}
+
+		ps, ok := statuses[pkg.Name]
+		if !ok {
+			if prev := kevi.Status.PackageStatus(pkg.Name); prev != nil {
+				ps, ok = *prev, true
+			}
+		}
+		if ok && ps.Digest != "" {
+			entry.Packages = append(entry.Packages, packagesv1alpha1.KeviPackageRevision{
+				Name:      pkg.Name,
+				Digest:    ps.Digest,
+				RenderKey: ps.RenderKey,
+				Revision:  ps.Revision,
+			})
+		}
+	}
+
+	if n := len(kevi.Status.History); n > 0 {
+		entry.ID = kevi.Status.History[n-1].ID + 1
+	} else {
+		entry.ID = 1
+	}
+
+	limit := defaultRevisionHistoryLimit
+	if kevi.Spec.RevisionHistoryLimit != nil {
+		limit = int(*kevi.Spec.RevisionHistoryLimit)
+	}
+
+	kevi.Status.History = trimHistory(append(kevi.Status.History, entry), limit, kevi.Spec.RollbackTo)
+}
+
+// trimHistory drops the oldest entries beyond the limit, keeping the entry a rollback is pinned to so the rollback can
+// go on re-syncing it
+func trimHistory(history []packagesv1alpha1.KeviRevisionHistory, limit int, rollbackTo *int64) []packagesv1alpha1.KeviRevisionHistory {
+	if limit <= 0 || len(history) <= limit {
+		return history
+	}
+
+	kept := history[len(history)-limit:]
+	if rollbackTo == nil {
+		return kept
+	}
+	for _, entry := range history[:len(history)-limit] {
+		if entry.ID == *rollbackTo {
+			return append([]packagesv1alpha1.KeviRevisionHistory{entry}, kept...)
+		}
+	}
+	return kept
+}
+
+// recordRollback records an automatic rollback to the history entry with the given ID
+func recordRollback(kevi *packagesv1alpha1.Kevi, statuses map[string]packagesv1alpha1.KeviPackageStatus, attempted map[string]packagesv1alpha1.KeviPackageRevision, syncErr error, to int64) {
+	recordHistory(kevi, statuses, attempted, syncErr, fmt.Sprintf("rolled back to revision %d", to))
+	if syncErr == nil {
+		kevi.Status.History[len(kevi.Status.History)-1].Result = packagesv1alpha1.KeviRevisionRolledBack
+	}
+}
+
+// lastSucceeded returns the most recent history entry that synced successfully, or nil if there is none
+func lastSucceeded(history []packagesv1alpha1.KeviRevisionHistory) *packagesv1alpha1.KeviRevisionHistory {
+	for i := len(history) - 1; i >= 0; i-- {
+		switch history[i].Result {
+		case packagesv1alpha1.KeviRevisionSucceeded, packagesv1alpha1.KeviRevisionRolledBack:
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// rolledBack returns true if the package failed to sync with the given render key and was then automatically rolled
+// back to a different one, packages that were unchanged by the failed sync are recorded with the same key in both
+func rolledBack(history []packagesv1alpha1.KeviRevisionHistory, name, renderKey string) bool {
+	failed := false
+	for _, entry := range history {
+		switch entry.Result {
+		case packagesv1alpha1.KeviRevisionFailed:
+			failed = failed || renderKeyOf(entry, name) == renderKey
+		case packagesv1alpha1.KeviRevisionRolledBack:
+			if failed && renderKeyOf(entry, name) != renderKey {
+				return true
+			}
+			failed = false
+		}
+	}
+	return false
+}
+
+func renderKeyOf(entry packagesv1alpha1.KeviRevisionHistory, name string) string {
+	for _, rev := range entry.Packages {
+		if rev.Name == name {
+			return rev.RenderKey
+		}
+	}
+	return ""
+}
+
+// pins returns the digest of every package recorded in a history entry
+func pins(entry *packagesv1alpha1.KeviRevisionHistory) map[string]string {
+	p := make(map[string]string)
+	for _, rev := range entry.Packages {
+		p[rev.Name] = rev.Digest
+	}
+	return p
+}
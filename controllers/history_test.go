@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestRecordHistory(t *testing.T) {
+	limit := int32(2)
+	kevi := &packagesv1alpha1.Kevi{
+		Spec: packagesv1alpha1.KeviSpec{
+			Packages:             []packagesv1alpha1.KeviSpecPackage{{Name: "a"}, {Name: "b"}},
+			RevisionHistoryLimit: &limit,
+		},
+		Status: packagesv1alpha1.KeviStatus{
+			Packages: []packagesv1alpha1.KeviPackageStatus{{Name: "b", Digest: "sha256:b1", RenderKey: "b1"}},
+		},
+	}
+
+	attempted := map[string]packagesv1alpha1.KeviPackageRevision{"a": {Name: "a", Digest: "sha256:a1", RenderKey: "a1"}}
+	recordHistory(kevi, nil, attempted, nil, "")
+	recordHistory(kevi, nil, attempted, errors.New("failed"), "")
+	recordRollback(kevi, nil, attempted, nil, 1)
+
+	h := kevi.Status.History
+	if len(h) != 2 {
+		t.Fatalf("recordHistory() kept %d entries, want 2", len(h))
+	}
+	if h[0].ID != 2 || h[0].Result != packagesv1alpha1.KeviRevisionFailed || h[0].Message != "failed" {
+		t.Errorf("recordHistory() got = %+v, want failed entry 2", h[0])
+	}
+	if h[1].ID != 3 || h[1].Result != packagesv1alpha1.KeviRevisionRolledBack {
+		t.Errorf("recordRollback() got = %+v, want rolled back entry 3", h[1])
+	}
+	if len(h[1].Packages) != 2 || h[1].Packages[1].Digest != "sha256:b1" {
+		t.Errorf("recordHistory() packages = %+v, want the unattempted package's last synced digest", h[1].Packages)
+	}
+	if last := lastSucceeded(h); last == nil || last.ID != 3 {
+		t.Errorf("lastSucceeded() got = %+v, want entry 3", last)
+	}
+}
+
+func TestRecordHistory_KeepsRollbackTo(t *testing.T) {
+	limit := int32(2)
+	to := int64(1)
+	kevi := &packagesv1alpha1.Kevi{
+		Spec: packagesv1alpha1.KeviSpec{
+			Packages:             []packagesv1alpha1.KeviSpecPackage{{Name: "a"}},
+			RevisionHistoryLimit: &limit,
+			RollbackTo:           &to,
+		},
+	}
+
+	attempted := map[string]packagesv1alpha1.KeviPackageRevision{"a": {Name: "a", Digest: "sha256:a1", RenderKey: "a1"}}
+	for i := 0; i < 4; i++ {
+		recordHistory(kevi, nil, attempted, nil, "")
+	}
+
+	var ids []int64
+	for _, entry := range kevi.Status.History {
+		ids = append(ids, entry.ID)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 4 {
+		t.Errorf("recordHistory() kept entries %v, want [1 3 4]", ids)
+	}
+	if kevi.Status.Revision(to) == nil {
+		t.Errorf("recordHistory() dropped the rollback revision %d", to)
+	}
+}
+
+func TestRolledBack(t *testing.T) {
+	rev := func(name, key string) packagesv1alpha1.KeviPackageRevision {
+		return packagesv1alpha1.KeviPackageRevision{Name: name, RenderKey: key}
+	}
+	history := []packagesv1alpha1.KeviRevisionHistory{
+		{ID: 1, Result: packagesv1alpha1.KeviRevisionSucceeded, Packages: []packagesv1alpha1.KeviPackageRevision{rev("a", "a1"), rev("b", "b1")}},
+		{ID: 2, Result: packagesv1alpha1.KeviRevisionFailed, Packages: []packagesv1alpha1.KeviPackageRevision{rev("a", "a2"), rev("b", "b1")}},
+		{ID: 3, Result: packagesv1alpha1.KeviRevisionRolledBack, Packages: []packagesv1alpha1.KeviPackageRevision{rev("a", "a1"), rev("b", "b1")}},
+		{ID: 4, Result: packagesv1alpha1.KeviRevisionFailed, Packages: []packagesv1alpha1.KeviPackageRevision{rev("a", "a1"), rev("b", "b2")}},
+	}
+
+	tests := []struct {
+		name, pkg, key string
+		want           bool
+	}{
+		{name: "failed and rolled back", pkg: "a", key: "a2", want: true},
+		{name: "unchanged by the failed sync", pkg: "b", key: "b1"},
+		{name: "failed without a rollback", pkg: "b", key: "b2"},
+		{name: "never failed", pkg: "a", key: "a3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolledBack(history, tt.pkg, tt.key); got != tt.want {
+				t.Errorf("rolledBack() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
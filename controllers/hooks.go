@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+const (
+	// HookAnnotation marks a resource as a hook run in the given sync phases, such as PreSync or PostSync
+	HookAnnotation = "kevi.cattle.io/hook"
+
+	// HookDeletePolicyAnnotation controls when a hook is deleted, such as HookSucceeded or BeforeHookCreation
+	HookDeletePolicyAnnotation = "kevi.cattle.io/hook-delete-policy"
+
+	// SyncWaveAnnotation orders resources within a sync phase, lower waves are synced and healthy before higher ones
+	SyncWaveAnnotation = "kevi.cattle.io/sync-wave"
+)
+
+// hookAnnotations maps kevi's annotations onto their gitops-engine equivalents
+var hookAnnotations = map[string]string{
+	HookAnnotation:             common.AnnotationKeyHook,
+	HookDeletePolicyAnnotation: common.AnnotationKeyHookDeletePolicy,
+	SyncWaveAnnotation:         common.AnnotationSyncWave,
+}
+
+// translateHooks copies kevi hook and sync wave annotations onto the equivalent gitops-engine annotations, helm hook
+// annotations are understood by gitops-engine as is
+func translateHooks(objs []*unstructured.Unstructured) {
+	for _, obj := range objs {
+		annotations := obj.GetAnnotations()
+		changed := false
+		for from, to := range hookAnnotations {
+			v, ok := annotations[from]
+			if !ok {
+				continue
+			}
+			if _, exists := annotations[to]; exists {
+				continue
+			}
+			annotations[to] = v
+			changed = true
+		}
+		if changed {
+			obj.SetAnnotations(annotations)
+		}
+	}
+}
+
+// hookStatuses returns the status of each hook in a sync's results
+func hookStatuses(results []common.ResourceSyncResult) []packagesv1alpha1.KeviHookStatus {
+	var hooks []packagesv1alpha1.KeviHookStatus
+	for _, res := range results {
+		if res.HookType == "" {
+			continue
+		}
+		hooks = append(hooks, packagesv1alpha1.KeviHookStatus{
+			KeviResourceStatus: packagesv1alpha1.KeviResourceStatus{
+				Group:     res.ResourceKey.Group,
+				Version:   res.Version,
+				Kind:      res.ResourceKey.Kind,
+				Namespace: res.ResourceKey.Namespace,
+				Name:      res.ResourceKey.Name,
+			},
+			HookType: string(res.HookType),
+			Phase:    string(res.HookPhase),
+			Message:  res.Message,
+		})
+	}
+	return hooks
+}
+
+// syncFailure returns an error describing the failed resources and hooks of a sync, or nil if it succeeded
+func syncFailure(results []common.ResourceSyncResult) error {
+	var failed []string
+	for _, res := range results {
+		if res.Status != common.ResultCodeSyncFailed && res.HookPhase != common.OperationFailed && res.HookPhase != common.OperationError {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s/%s: %s", res.ResourceKey.Kind, res.ResourceKey.Name, res.Message))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("sync failed: %s", strings.Join(failed, "; "))
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTranslateHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]string
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "hook and wave",
+			annotations: map[string]string{
+				HookAnnotation:             "PreSync",
+				HookDeletePolicyAnnotation: "HookSucceeded",
+				SyncWaveAnnotation:         "-1",
+			},
+			want: map[string]string{
+				HookAnnotation:                       "PreSync",
+				HookDeletePolicyAnnotation:           "HookSucceeded",
+				SyncWaveAnnotation:                   "-1",
+				common.AnnotationKeyHook:             "PreSync",
+				common.AnnotationKeyHookDeletePolicy: "HookSucceeded",
+				common.AnnotationSyncWave:            "-1",
+			},
+		},
+		{
+			name: "existing gitops-engine annotations win",
+			annotations: map[string]string{
+				SyncWaveAnnotation:        "1",
+				common.AnnotationSyncWave: "2",
+			},
+			want: map[string]string{
+				SyncWaveAnnotation:        "1",
+				common.AnnotationSyncWave: "2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newDeployment(1, "app")
+			obj.SetAnnotations(tt.annotations)
+
+			translateHooks([]*unstructured.Unstructured{obj})
+
+			if got := obj.GetAnnotations(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("translateHooks() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncFailure(t *testing.T) {
+	migrate := kube.ResourceKey{Group: "batch", Kind: "Job", Namespace: "default", Name: "migrate"}
+	app := kube.ResourceKey{Group: "apps", Kind: "Deployment", Namespace: "default", Name: "app"}
+
+	tests := []struct {
+		name      string
+		results   []common.ResourceSyncResult
+		wantHooks int
+		wantErr   bool
+	}{
+		{
+			name: "succeeded",
+			results: []common.ResourceSyncResult{
+				{ResourceKey: migrate, HookType: common.HookTypePreSync, HookPhase: common.OperationSucceeded},
+				{ResourceKey: app, Status: common.ResultCodeSynced},
+			},
+			wantHooks: 1,
+		},
+		{
+			name: "hook failed",
+			results: []common.ResourceSyncResult{
+				{ResourceKey: migrate, HookType: common.HookTypePreSync, HookPhase: common.OperationFailed, Message: "job failed"},
+			},
+			wantHooks: 1,
+			wantErr:   true,
+		},
+		{
+			name: "resource failed",
+			results: []common.ResourceSyncResult{
+				{ResourceKey: app, Status: common.ResultCodeSyncFailed, Message: "invalid"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := syncFailure(tt.results); (err != nil) != tt.wantErr {
+				t.Errorf("syncFailure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := hookStatuses(tt.results); len(got) != tt.wantHooks {
+				t.Errorf("hookStatuses() got %d hooks, want %d", len(got), tt.wantHooks)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/diff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+var _ diff.Normalizer = &ignoreNormalizer{}
+
+// ignoreRule is a parsed KeviResourceIgnoreDifferences
+type ignoreRule struct {
+	packagesv1alpha1.KeviResourceIgnoreDifferences
+
+	paths [][]segment
+}
+
+// segment is a single step of an ignored field path
+type segment struct {
+	// key of an object field, also used as an index when the value is an array and the key is numeric
+	key   string
+	index int
+
+	// wildcard matches every element of an array
+	wildcard bool
+
+	// selectKey and selectValue match array elements where .selectKey == selectValue
+	selectKey   string
+	selectValue string
+}
+
+func (s segment) isArrayOnly() bool {
+	return s.wildcard || s.selectKey != ""
+}
+
+func (s segment) matches(i int, v interface{}) bool {
+	switch {
+	case s.wildcard:
+		return true
+	case s.selectKey != "":
+		m, ok := v.(map[string]interface{})
+		return ok && fmt.Sprint(m[s.selectKey]) == s.selectValue
+	default:
+		return s.index >= 0 && s.index == i
+	}
+}
+
+// counterpart returns the index of the element in arr corresponding to the matched element at index i
+func (s segment) counterpart(arr []interface{}, i int, v interface{}) int {
+	if s.selectKey != "" {
+		for j, e := range arr {
+			if s.matches(j, e) {
+				return j
+			}
+		}
+		return -1
+	}
+	if i < len(arr) {
+		return i
+	}
+	return -1
+}
+
+func parseIgnoreRules(rules []packagesv1alpha1.KeviResourceIgnoreDifferences) ([]ignoreRule, error) {
+	var parsed []ignoreRule
+	for _, r := range rules {
+		ir := ignoreRule{KeviResourceIgnoreDifferences: r}
+		for _, p := range r.JSONPointers {
+			segs, err := parseJSONPointer(p)
+			if err != nil {
+				return nil, err
+			}
+			ir.paths = append(ir.paths, segs)
+		}
+		for _, p := range r.JQPathExpressions {
+			segs, err := parseJQPath(p)
+			if err != nil {
+				return nil, err
+			}
+			ir.paths = append(ir.paths, segs)
+		}
+		parsed = append(parsed, ir)
+	}
+	return parsed, nil
+}
+
+func parseJSONPointer(p string) ([]segment, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q, must start with /", p)
+	}
+
+	var segs []segment
+	for _, tok := range strings.Split(p[1:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		seg := segment{key: tok, index: -1}
+		if i, err := strconv.Atoi(tok); err == nil {
+			seg.index = i
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+func parseJQPath(p string) ([]segment, error) {
+	var segs []segment
+	for _, part := range strings.Split(p, "|") {
+		part = strings.TrimSpace(part)
+
+		if strings.HasPrefix(part, "select(") {
+			if len(segs) == 0 || !segs[len(segs)-1].wildcard {
+				return nil, fmt.Errorf("invalid jq path %q, select must follow []", p)
+			}
+			key, value, err := parseJQSelect(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jq path %q: %w", p, err)
+			}
+			segs[len(segs)-1] = segment{index: -1, selectKey: key, selectValue: value}
+			continue
+		}
+
+		if !strings.HasPrefix(part, ".") {
+			return nil, fmt.Errorf("invalid jq path %q, expected a leading .", p)
+		}
+
+		for _, field := range strings.Split(part[1:], ".") {
+			name := field
+			var brackets []string
+			if i := strings.Index(field, "["); i >= 0 {
+				name = field[:i]
+				for _, b := range strings.Split(field[i:], "]") {
+					if b == "" {
+						continue
+					}
+					if !strings.HasPrefix(b, "[") {
+						return nil, fmt.Errorf("invalid jq path %q, malformed brackets in %q", p, field)
+					}
+					brackets = append(brackets, strings.TrimPrefix(b, "["))
+				}
+			}
+
+			if name != "" {
+				segs = append(segs, segment{key: name, index: -1})
+			}
+			for _, b := range brackets {
+				if b == "" {
+					segs = append(segs, segment{index: -1, wildcard: true})
+					continue
+				}
+				i, err := strconv.Atoi(b)
+				if err != nil {
+					return nil, fmt.Errorf("invalid jq path %q, index %q is not a number", p, b)
+				}
+				segs = append(segs, segment{key: b, index: i})
+			}
+		}
+	}
+
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("invalid jq path %q, no fields selected", p)
+	}
+	return segs, nil
+}
+
+// parseJQSelect parses select(.key == "value")
+func parseJQSelect(s string) (string, string, error) {
+	expr := strings.TrimSuffix(strings.TrimPrefix(s, "select("), ")")
+	parts := strings.SplitN(expr, "==", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("only select(.field == value) is supported")
+	}
+
+	key := strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(key, ".") || strings.Contains(key[1:], ".") {
+		return "", "", fmt.Errorf("select only supports a single top level field")
+	}
+	value := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	return key[1:], value, nil
+}
+
+func (r ignoreRule) appliesTo(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return r.Matches(gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName())
+}
+
+// ignoreNormalizer removes ignored fields before objects are diffed
+type ignoreNormalizer struct {
+	rules []ignoreRule
+}
+
+func (n *ignoreNormalizer) Normalize(un *unstructured.Unstructured) error {
+	if un == nil {
+		return nil
+	}
+	for _, r := range n.rules {
+		if !r.appliesTo(un) {
+			continue
+		}
+		for _, p := range r.paths {
+			un.Object = removePath(un.Object, p).(map[string]interface{})
+		}
+	}
+	return nil
+}
+
+// respectIgnored overwrites ignored fields of target with their live values, so syncing never reverts them
+func respectIgnored(rules []ignoreRule, target, live *unstructured.Unstructured) {
+	for _, r := range rules {
+		if !r.appliesTo(target) {
+			continue
+		}
+		for _, p := range r.paths {
+			target.Object = copyPath(target.Object, live.Object, p).(map[string]interface{})
+		}
+	}
+}
+
+func removePath(v interface{}, segs []segment) interface{} {
+	if len(segs) == 0 {
+		return v
+	}
+	seg, rest := segs[0], segs[1:]
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if seg.isArrayOnly() {
+			return v
+		}
+		child, ok := t[seg.key]
+		if !ok {
+			return v
+		}
+		if len(rest) == 0 {
+			delete(t, seg.key)
+			return t
+		}
+		t[seg.key] = removePath(child, rest)
+		return t
+
+	case []interface{}:
+		out := make([]interface{}, 0, len(t))
+		for i, e := range t {
+			if !seg.matches(i, e) {
+				out = append(out, e)
+				continue
+			}
+			if len(rest) == 0 {
+				continue
+			}
+			out = append(out, removePath(e, rest))
+		}
+		return out
+	}
+	return v
+}
+
+func copyPath(target interface{}, live interface{}, segs []segment) interface{} {
+	if len(segs) == 0 {
+		return runtime.DeepCopyJSONValue(live)
+	}
+	seg, rest := segs[0], segs[1:]
+
+	switch l := live.(type) {
+	case map[string]interface{}:
+		t, ok := target.(map[string]interface{})
+		if !ok || seg.isArrayOnly() {
+			return target
+		}
+
+		lc, ok := l[seg.key]
+		if !ok {
+			if len(rest) == 0 {
+				delete(t, seg.key)
+			}
+			return t
+		}
+
+		tc, ok := t[seg.key]
+		if !ok {
+			if len(rest) == 0 {
+				t[seg.key] = runtime.DeepCopyJSONValue(lc)
+				return t
+			}
+			if _, isMap := lc.(map[string]interface{}); !isMap {
+				return t
+			}
+			tc = map[string]interface{}{}
+		}
+		t[seg.key] = copyPath(tc, lc, rest)
+		return t
+
+	case []interface{}:
+		t, ok := target.([]interface{})
+		if !ok {
+			return target
+		}
+		for i, le := range l {
+			if !seg.matches(i, le) {
+				continue
+			}
+			j := seg.counterpart(t, i, le)
+			switch {
+			case j < 0 && len(rest) == 0:
+				t = append(t, runtime.DeepCopyJSONValue(le))
+			case j < 0:
+				continue
+			case len(rest) == 0:
+				t[j] = runtime.DeepCopyJSONValue(le)
+			default:
+				t[j] = copyPath(t[j], le, rest)
+			}
+		}
+		return t
+	}
+	return target
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func newDeployment(replicas int64, containers ...string) *unstructured.Unstructured {
+	var cs []interface{}
+	for _, c := range containers {
+		cs = append(cs, map[string]interface{}{"name": c, "image": c + ":latest"})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": cs},
+			},
+		},
+	}}
+}
+
+func TestParseJQPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []segment
+		wantErr bool
+	}{
+		{
+			path: ".spec.replicas",
+			want: []segment{{key: "spec", index: -1}, {key: "replicas", index: -1}},
+		},
+		{
+			path: ".webhooks[].clientConfig.caBundle",
+			want: []segment{{key: "webhooks", index: -1}, {index: -1, wildcard: true}, {key: "clientConfig", index: -1}, {key: "caBundle", index: -1}},
+		},
+		{
+			path: ".spec.containers[0]",
+			want: []segment{{key: "spec", index: -1}, {key: "containers", index: -1}, {key: "0", index: 0}},
+		},
+		{
+			path: `.spec.containers[] | select(.name == "istio-proxy")`,
+			want: []segment{{key: "spec", index: -1}, {key: "containers", index: -1}, {index: -1, selectKey: "name", selectValue: "istio-proxy"}},
+		},
+		{path: "spec.replicas", wantErr: true},
+		{path: `.spec | select(.name == "x")`, wantErr: true},
+		{path: ".spec.containers[a]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJQPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJQPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJQPath() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreNormalizer(t *testing.T) {
+	rules, err := parseIgnoreRules([]packagesv1alpha1.KeviResourceIgnoreDifferences{{
+		KeviResourceSelector: packagesv1alpha1.KeviResourceSelector{Group: "apps", Kind: "Deployment"},
+		JSONPointers:         []string{"/spec/replicas"},
+		JQPathExpressions:    []string{`.spec.template.spec.containers[] | select(.name == "sidecar")`},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := newDeployment(5, "app", "sidecar")
+	target := newDeployment(1, "app")
+
+	n := &ignoreNormalizer{rules: rules}
+	for _, u := range []*unstructured.Unstructured{live, target} {
+		if err := n.Normalize(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(live.Object, target.Object) {
+		t.Errorf("Normalize() objects differ after ignoring fields:\nlive:   %v\ntarget: %v", live.Object, target.Object)
+	}
+}
+
+func TestRespectIgnored(t *testing.T) {
+	rules, err := parseIgnoreRules([]packagesv1alpha1.KeviResourceIgnoreDifferences{{
+		KeviResourceSelector: packagesv1alpha1.KeviResourceSelector{Group: "apps", Kind: "Deployment", Name: "app"},
+		JQPathExpressions:    []string{".spec.replicas", `.spec.template.spec.containers[] | select(.name == "sidecar")`},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := newDeployment(1, "app")
+	respectIgnored(rules, target, newDeployment(5, "app", "sidecar"))
+
+	if want := newDeployment(5, "app", "sidecar"); !reflect.DeepEqual(target.Object, want.Object) {
+		t.Errorf("respectIgnored() got = %v, want %v", target.Object, want.Object)
+	}
+
+	other := newDeployment(1, "app")
+	other.SetName("other")
+	respectIgnored(rules, other, newDeployment(5, "app"))
+	if replicas, _, _ := unstructured.NestedInt64(other.Object, "spec", "replicas"); replicas != 1 {
+		t.Errorf("respectIgnored() modified a resource the rule does not apply to")
+	}
+}
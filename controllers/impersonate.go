@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/argoproj/gitops-engine/pkg/cache"
+	"github.com/argoproj/gitops-engine/pkg/engine"
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+// syncer is what a Kevi's packages are compared with and applied with
+type syncer struct {
+	cache     cache.ClusterCache
+	engine    engine.GitOpsEngine
+	resources *ssa.ResourceManager
+}
+
+// NewResourceManager returns a server side apply resource manager for the given config, owned by kevi
+func NewResourceManager(cfg *rest.Config) (*ssa.ResourceManager, error) {
+	restMapper, err := apiutil.NewDynamicRESTMapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kc, err := client.New(cfg, client.Options{Mapper: restMapper})
+	if err != nil {
+		return nil, err
+	}
+
+	poller := polling.NewStatusPoller(kc, restMapper)
+	return ssa.NewResourceManager(kc, poller, ssa.Owner{
+		Field: "kevi",
+		Group: "cattle.io",
+	}), nil
+}
+
+// syncerFor returns the syncer for a Kevi on its target cluster, impersonating the Kevi's service account when it sets
+// one. Impersonating syncers share the cluster's cache, so only writes are limited by the service account's RBAC.
+func (r *KeviReconciler) syncerFor(kevi *packagesv1alpha1.Kevi, tc *targetCluster) (syncer, error) {
+	sa := kevi.Spec.ServiceAccountName
+	if sa == "" {
+		if r.RequireServiceAccount {
+			return syncer{}, fmt.Errorf("spec.serviceAccountName is required")
+		}
+		return syncer{cache: tc.cache, engine: tc.engine, resources: tc.resources}, nil
+	}
+
+	if tc.config == nil || tc.cache == nil {
+		return syncer{}, fmt.Errorf("impersonating service accounts requires a rest config and cluster cache")
+	}
+
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", kevi.Namespace, sa)
+
+	r.clustersMu.Lock()
+	s, ok := tc.syncers[username]
+	r.clustersMu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	cfg := rest.CopyConfig(tc.config)
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: username}
+
+	// discovering the target's resources happens outside the lock, a racing reconcile's syncer is used instead
+	rm, err := NewResourceManager(cfg)
+	if err != nil {
+		return syncer{}, err
+	}
+
+	r.clustersMu.Lock()
+	defer r.clustersMu.Unlock()
+	if s, ok := tc.syncers[username]; ok {
+		return s, nil
+	}
+
+	s = syncer{
+		cache:     tc.cache,
+		engine:    engine.NewEngine(cfg, tc.cache),
+		resources: rm,
+	}
+	if tc.syncers == nil {
+		tc.syncers = make(map[string]syncer)
+	}
+	tc.syncers[username] = s
+	return s, nil
+}
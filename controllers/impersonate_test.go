@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestSyncerFor(t *testing.T) {
+	kevi := func(sa string) *packagesv1alpha1.Kevi {
+		return &packagesv1alpha1.Kevi{
+			ObjectMeta: metav1.ObjectMeta{Name: "kevi", Namespace: "default"},
+			Spec:       packagesv1alpha1.KeviSpec{ServiceAccountName: sa},
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		kevi                  *packagesv1alpha1.Kevi
+		requireServiceAccount bool
+		wantErr               bool
+	}{
+		{
+			name: "no service account",
+			kevi: kevi(""),
+		},
+		{
+			name:                  "service account required",
+			kevi:                  kevi(""),
+			requireServiceAccount: true,
+			wantErr:               true,
+		},
+		{
+			name:    "service account without config",
+			kevi:    kevi("deployer"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &KeviReconciler{RequireServiceAccount: tt.requireServiceAccount}
+			tc := &targetCluster{name: inCluster}
+
+			s, err := r.syncerFor(tt.kevi, tc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncerFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (s.engine != tc.engine || s.resources != tc.resources) {
+				t.Errorf("syncerFor() didn't return the cluster's syncer")
+			}
+		})
+	}
+}
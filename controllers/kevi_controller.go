@@ -18,14 +18,28 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gosync "sync"
+	"time"
 
 	"github.com/argoproj/gitops-engine/pkg/cache"
 	"github.com/argoproj/gitops-engine/pkg/sync"
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
 	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/argoproj/gitops-engine/pkg/engine"
@@ -33,6 +47,7 @@ import (
 	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
 	"cattle.io/kevi/pkg/fetcher"
 	"cattle.io/kevi/pkg/pack"
+	"cattle.io/kevi/pkg/webhook"
 )
 
 // KeviReconciler reconciles a Kevi object
@@ -42,6 +57,51 @@ type KeviReconciler struct {
 
 	Fetcher fetcher.Fetcher
 	Engine  engine.GitOpsEngine
+
+	// Cache is an optional cache of fetched packages and rendered manifests
+	Cache *pack.Cache
+
+	// LoadOptions configure how package content is fetched, such as a disk backed store and size limits
+	LoadOptions []pack.LoadOption
+
+	// MaxConcurrentReconciles is the maximum number of Kevis reconciled at once
+	MaxConcurrentReconciles int
+
+	// ClusterCache is the gitops-engine cluster cache of the controller's own cluster backing Engine, used to compare
+	// live and rendered state
+	ClusterCache cache.ClusterCache
+
+	// DriftInterval is how often synced Kevis are re-evaluated for drift, 0 disables periodic drift detection
+	DriftInterval time.Duration
+
+	// ResourceManager applies resources configured for server side apply
+	ResourceManager *ssa.ResourceManager
+
+	// Config is the controller's rest config, impersonated to sync Kevis that set a service account to its own cluster
+	Config *rest.Config
+
+	// RelocateRegistry rewrites the images of rendered manifests to this registry before they're compared or synced, so
+	// live resources reference the airgap registry without relying on the pod relocating webhook. Empty disables it.
+	RelocateRegistry string
+
+	// RelocationStrategy maps images to their relocated repository, it must match the pod relocating webhook's
+	RelocationStrategy pack.RelocationStrategy
+
+	// ImageRules are the pod relocating webhook's rules for resources other than pods. Their images are relocated with
+	// RelocateRegistry, and images the webhook relocated are compared by their original reference.
+	ImageRules []webhook.ImageRule
+
+	// RequireServiceAccount refuses to sync Kevis that don't set a service account, so the controller's own
+	// credentials are never used to apply resources
+	RequireServiceAccount bool
+
+	// AllowUnsafeKubeConfigs lets the kubeconfigs of remote targets run plugins and read files in the controller's pod
+	AllowUnsafeKubeConfigs bool
+
+	clustersMu  gosync.Mutex
+	local       *targetCluster
+	clusters    map[string]*targetCluster
+	targetLocks map[string]*gosync.Mutex
 }
 
 type GCMark struct {
@@ -50,69 +110,472 @@ type GCMark struct {
 
 const (
 	GCAnnotationMark = "kevi.cattle.io/gc-mark"
+
+	// syncNamespace is the namespace resources without one are synced to
+	syncNamespace = "default"
 )
 
-// TODO: Extremely privileged b/c of gitopsengine's scope, should tone this down a notch
-// +kubebuilder:rbac:groups=*,resources=*,verbs=*
-// OLD: +kubebuilder:rbac:groups=packages.cattle.io,resources=kevis,verbs=get;list;watch;create;update;patch;delete
-// OLD: +kubebuilder:rbac:groups=packages.cattle.io,resources=kevis/status,verbs=get;update;patch
-// OLD: +kubebuilder:rbac:groups=packages.cattle.io,resources=kevis/finalizers,verbs=update
+// The controller only needs to read everything for gitops-engine's cluster cache, and impersonate the service accounts
+// Kevis are synced as. Installs that sync Kevis without a service account additionally bind kevi-manager-sync-role.
+// +kubebuilder:rbac:groups=*,resources=*,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=impersonate
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=update;patch
+// +kubebuilder:rbac:groups=packages.cattle.io,resources=kevis,verbs=update;patch
+// +kubebuilder:rbac:groups=packages.cattle.io,resources=kevis/status,verbs=update;patch
 
 func (r *KeviReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	l := log.FromContext(ctx)
-
 	var kevi packagesv1alpha1.Kevi
 	if err := r.Get(ctx, req.NamespacedName, &kevi); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	for _, pkg := range kevi.Spec.Packages {
-		l.Info("processing package", "pkg", pkg.Name)
+	levels, err := packageLevels(kevi.Spec.Packages)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-		p, err := pack.Load(ctx, r.Fetcher, pkg)
-		if err != nil {
-			return ctrl.Result{}, err
+	requested, force := syncRequest(&kevi)
+	gate := syncGate{force: force}
+	if kevi.Spec.Suspend {
+		gate.blocked = "suspended"
+		// suspended Kevis aren't rendered or checked for drift at all
+		levels = nil
+	} else if gate.blocked, err = syncBlocked(kevi.Spec.SyncWindows, time.Now(), force); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if kevi.Spec.RollbackTo != nil && gate.blocked == "" {
+		if entry := kevi.Status.Revision(*kevi.Spec.RollbackTo); entry != nil {
+			gate.pins = pins(entry)
+		} else {
+			gate.blocked = fmt.Sprintf("rollback revision %d isn't recorded in history", *kevi.Spec.RollbackTo)
 		}
+	}
 
-		data, err := p.Generate()
-		if err != nil {
+	var (
+		tc *targetCluster
+		s  syncer
+	)
+	if !kevi.Spec.Suspend {
+		if tc, err = r.clusterFor(ctx, &kevi); err != nil {
+			kevi.Status.Cluster = &packagesv1alpha1.KeviClusterStatus{Name: targetName(&kevi), Message: err.Error()}
+			if uerr := r.Status().Update(ctx, &kevi); uerr != nil {
+				return ctrl.Result{}, uerr
+			}
 			return ctrl.Result{}, err
 		}
+		kevi.Status.Cluster = clusterStatus(tc)
+		s.cache = tc.cache
+	}
+
+	if kevi.Spec.RequireApproval && gate.blocked == "" {
+		if s.cache == nil {
+			return ctrl.Result{}, fmt.Errorf("approvals require a cluster cache to plan changes against")
+		}
 
-		objs, err := kube.SplitYAML(data)
+		plan, revisions, err := r.plan(ctx, &kevi, gate, s.cache)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 
-		l.Info("Syncing package", "package", pkg.Name, "# objects", len(objs))
-		if err := r.sync(ctx, objs); err != nil {
+		// packages are only synced at the revisions that were planned, so a revision pushed after planning, even when
+		// there was nothing to approve, waits for the next plan
+		kevi.Status.Plan = plan
+		gate.revisions = revisions
+		if plan != nil && kevi.GetAnnotations()[ApprovedPlanAnnotation] != plan.Hash {
+			gate.blocked = "awaiting approval of plan " + plan.Hash
+		}
+	}
+
+	if r.RequireServiceAccount && kevi.Spec.ServiceAccountName == "" && gate.blocked == "" {
+		gate.blocked = "spec.serviceAccountName is required"
+	}
+
+	if gate.blocked == "" {
+		if s, err = r.syncerFor(&kevi, tc); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	statuses, attempted, syncErr := r.syncLevels(ctx, &kevi, levels, gate, s)
+	if len(attempted) > 0 {
+		message := ""
+		if kevi.Spec.RollbackTo != nil {
+			message = fmt.Sprintf("rollback to revision %d", *kevi.Spec.RollbackTo)
+		}
+		recordHistory(&kevi, statuses, attempted, syncErr, message)
+	}
+
+	if syncErr != nil && kevi.Spec.AutoRollback && gate.pins == nil {
+		if last := lastSucceeded(kevi.Status.History); last != nil {
+			log.FromContext(ctx).Info("Rolling back failed sync", "revision", last.ID, "error", syncErr.Error())
+
+			// every package is re-synced at its last successful digest, starting from the failed sync's status
+			kevi.Status.Packages = packageStatuses(&kevi, statuses)
+			rollback := syncGate{force: true, pins: pins(last)}
+			rstatuses, rattempted, rerr := r.syncLevels(ctx, &kevi, levels, rollback, s)
+			for name, ps := range rstatuses {
+				statuses[name] = ps
+			}
+			recordRollback(&kevi, statuses, rattempted, rerr, last.ID)
+			syncErr = rerr
+		}
+	}
+
+	// statuses are recorded even when a package fails, so hook failures are visible on the Kevi
+	kevi.Status.ObservedGeneration = kevi.Generation
+	kevi.Status.Packages = packageStatuses(&kevi, statuses)
+	if kevi.Spec.Suspend {
+		for i := range kevi.Status.Packages {
+			kevi.Status.Packages[i].SyncSkipped = gate.blocked
+		}
+	}
+	if force && gate.blocked == "" && syncErr == nil {
+		kevi.Status.LastHandledReconcileAt = requested
+	}
+	if gate.revisions != nil && syncErr == nil {
+		kevi.Status.Plan = nil
+	}
+	if err := r.Status().Update(ctx, &kevi); err != nil {
+		return ctrl.Result{}, err
+	}
+	if syncErr != nil {
+		return ctrl.Result{}, syncErr
+	}
+
+	switch {
+	case kevi.Spec.Suspend:
+		return ctrl.Result{}, nil
+	case gate.blocked != "" && (r.DriftInterval == 0 || r.DriftInterval > windowRequeue):
+		return ctrl.Result{RequeueAfter: windowRequeue}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.DriftInterval}, nil
+}
+
+// syncGate decides whether packages are synced during a single reconcile
+type syncGate struct {
+	// force syncs packages even when their rendered content is unchanged
+	force bool
+
+	// blocked is the reason syncs are skipped, empty if they're allowed
+	blocked string
+
+	// revisions are the package revisions a plan was computed from, packages are only synced at their planned revision
+	revisions map[string]string
+
+	// pins are package digests to sync instead of the digests the packages' references currently resolve to
+	pins map[string]string
+}
+
+// syncLevels reconciles each level of packages in order, returning the status of every reconciled package and the
+// revisions of the packages a sync was attempted for
+func (r *KeviReconciler) syncLevels(ctx context.Context, kevi *packagesv1alpha1.Kevi, levels [][]packagesv1alpha1.KeviSpecPackage, gate syncGate, s syncer) (map[string]packagesv1alpha1.KeviPackageStatus, map[string]packagesv1alpha1.KeviPackageRevision, error) {
+	var (
+		mu        gosync.Mutex
+		statuses  = make(map[string]packagesv1alpha1.KeviPackageStatus)
+		attempted = make(map[string]packagesv1alpha1.KeviPackageRevision)
+	)
+	for _, level := range levels {
+		g, gctx := errgroup.WithContext(ctx)
+		for _, pkg := range level {
+			pkg := pkg
+			g.Go(func() error {
+				ps, rev, err := r.reconcilePackage(gctx, kevi, pkg, gate, s)
+
+				mu.Lock()
+				defer mu.Unlock()
+				statuses[pkg.Name] = ps
+				if rev != nil {
+					attempted[pkg.Name] = *rev
+				}
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return statuses, attempted, err
+		}
+	}
+	return statuses, attempted, nil
+}
+
+// packageStatuses orders the reconciled statuses by the Kevi's packages, keeping the previous status of any package
+// that wasn't reconciled
+func packageStatuses(kevi *packagesv1alpha1.Kevi, statuses map[string]packagesv1alpha1.KeviPackageStatus) []packagesv1alpha1.KeviPackageStatus {
+	var out []packagesv1alpha1.KeviPackageStatus
+	for _, pkg := range kevi.Spec.Packages {
+		ps, ok := statuses[pkg.Name]
+		if !ok {
+			ps = packagesv1alpha1.KeviPackageStatus{Name: pkg.Name}
+			if prev := kevi.Status.PackageStatus(pkg.Name); prev != nil {
+				ps = *prev
+			}
+		}
+		out = append(out, ps)
+	}
+	return out
+}
+
+// reconcilePackage syncs a package when its rendered content changes, otherwise it checks the package's live
+// resources for drift and re-syncs them when the Kevi is configured to self heal
+func (r *KeviReconciler) reconcilePackage(ctx context.Context, kevi *packagesv1alpha1.Kevi, pkg packagesv1alpha1.KeviSpecPackage, gate syncGate, s syncer) (packagesv1alpha1.KeviPackageStatus, *packagesv1alpha1.KeviPackageRevision, error) {
+	l := log.FromContext(ctx)
+	l.Info("processing package", "pkg", pkg.Name)
+
+	status := packagesv1alpha1.KeviPackageStatus{Name: pkg.Name}
+	if prev := kevi.Status.PackageStatus(pkg.Name); prev != nil {
+		status = *prev
+	}
+	status.SyncSkipped = ""
+
+	rp, err := r.prepare(ctx, kevi, pkg, gate.pins[pkg.Name])
+	if err != nil {
+		return status, nil, err
+	}
+	objs, mark, rules, revision := rp.objs, rp.mark, rp.rules, rp.rev.Revision
+
+	if status.Revision == revision && !gate.force && s.cache != nil {
+		drifted, err := r.drift(ctx, s.cache, objs, mark, rules)
+		if err != nil {
+			return status, nil, err
+		}
+
+		status.Drifted = drifted
+		if len(drifted) == 0 || !kevi.Spec.SelfHeal {
+			return status, nil, nil
+		}
+		l.Info("Self healing drifted package", "package", pkg.Name, "# drifted", len(drifted))
+	}
+
+	if planned, ok := gate.revisions[pkg.Name]; gate.revisions != nil && (!ok || planned != revision) {
+		gate.blocked = "revision changed since it was planned"
+	}
+	if kevi.Spec.AutoRollback && gate.pins == nil && !gate.force && rolledBack(kevi.Status.History, pkg.Name, rp.rev.RenderKey) {
+		gate.blocked = "revision " + rp.rev.Digest + " failed and was rolled back"
+	}
+	if gate.blocked != "" {
+		l.Info("Skipping sync", "package", pkg.Name, "reason", gate.blocked)
+		status.SyncSkipped = gate.blocked
+		return status, nil, nil
+	}
+
+	if len(rules) > 0 && s.cache != nil {
+		live, err := s.cache.GetManagedLiveObjs(objs, isManaged(mark))
+		if err != nil {
+			return status, nil, err
+		}
+		for _, obj := range objs {
+			if l, ok := live[kube.GetResourceKey(obj)]; ok && l != nil {
+				respectIgnored(rules, obj, l)
+			}
+		}
+	}
+
+	l.Info("Syncing package", "package", pkg.Name, "# objects", len(objs))
+	results, err := r.sync(ctx, s, objs, mark, pkg.SyncOptions)
+	status.Hooks = hookStatuses(results)
+	if err == nil {
+		err = syncFailure(results)
+	}
+	if err != nil {
+		status.SyncError = err.Error()
+		return status, &rp.rev, err
+	}
+
+	now := metav1.Now()
+	status.Revision = revision
+	status.Digest = rp.rev.Digest
+	status.RenderKey = rp.rev.RenderKey
+	status.LastSyncedAt = &now
+	status.Drifted = nil
+	status.SyncError = ""
+	return status, &rp.rev, nil
+}
+
+// preparedPackage is a package's rendered objects, ready to be synced or compared with live state
+type preparedPackage struct {
+	objs  []*unstructured.Unstructured
+	mark  string
+	rules []ignoreRule
+	rev   packagesv1alpha1.KeviPackageRevision
+}
+
+// prepare renders a package, at pin if it's set, relocates its images when configured, and annotates its objects with the
+// package's gc mark and translated sync annotations
+func (r *KeviReconciler) prepare(ctx context.Context, kevi *packagesv1alpha1.Kevi, pkg packagesv1alpha1.KeviSpecPackage, pin string) (*preparedPackage, error) {
+	data, rev, err := r.render(ctx, pkg, pin)
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := kube.SplitYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	mark := gcMark(kevi, pkg)
+	for _, obj := range objs {
+		if r.RelocateRegistry != "" {
+			pack.RelocateImages(obj.Object, r.RelocateRegistry, r.RelocationStrategy)
+			if paths := r.imageRulePaths(obj.GroupVersionKind()); len(paths) > 0 {
+				pack.RelocateImagePaths(obj.Object, paths, r.RelocateRegistry, r.RelocationStrategy)
+			}
+		}
+
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[GCAnnotationMark] = mark
+		obj.SetAnnotations(annotations)
+	}
+	translateSyncOptions(objs)
+	translateHooks(objs)
+
+	rules, err := parseIgnoreRules(pkg.IgnoreDifferences)
+	if err != nil {
+		return nil, err
+	}
+
+	return &preparedPackage{
+		objs:  objs,
+		mark:  mark,
+		rules: rules,
+		rev:   rev,
+	}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *KeviReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&packagesv1alpha1.Kevi{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
-func (r *KeviReconciler) sync(ctx context.Context, objs []*unstructured.Unstructured) error {
+// render fetches and renders a package at pin, or at the digest its reference currently resolves to when pin is
+// empty, skipping either step when the package's digest and inputs are already cached
+func (r *KeviReconciler) render(ctx context.Context, pkg packagesv1alpha1.KeviSpecPackage, pin string) ([]byte, packagesv1alpha1.KeviPackageRevision, error) {
+	rev := packagesv1alpha1.KeviPackageRevision{Name: pkg.Name}
+
+	var desc ocispec.Descriptor
+	if pin != "" {
+		d, err := digest.Parse(pin)
+		if err != nil {
+			return nil, rev, err
+		}
+		desc.Digest = d
+	} else {
+		var err error
+		if desc, err = r.Fetcher.Resolve(ctx, pkg); err != nil {
+			return nil, rev, err
+		}
+	}
+
+	key, err := pack.RenderKey(desc, pkg)
+	if err != nil {
+		return nil, rev, err
+	}
+	rev.Digest = desc.Digest.String()
+	rev.RenderKey = key
+
+	if r.Cache == nil {
+		opts := append([]pack.LoadOption{pack.WithDigest(desc.Digest)}, r.LoadOptions...)
+		p, err := pack.Load(ctx, r.Fetcher, pkg, opts...)
+		if err != nil {
+			return nil, rev, err
+		}
+		defer p.Close()
+
+		data, err := p.Generate()
+		if err != nil {
+			return nil, rev, err
+		}
+		rev.Revision = revision(data)
+		return data, rev, nil
+	}
+
+	if data, ok := r.Cache.GetRendered(key); ok {
+		cacheHits.WithLabelValues("render").Inc()
+		rev.Revision = revision(data)
+		return data, rev, nil
+	}
+	cacheMisses.WithLabelValues("render").Inc()
+
+	// a cached package evicted and closed since it was looked up is loaded again
+	var data []byte
+	p, ok := r.Cache.GetPackage(desc)
+	if ok {
+		data, err = p.Generate()
+		if errors.Is(err, pack.ErrPackageClosed) {
+			ok = false
+		} else if err != nil {
+			return nil, rev, err
+		}
+	}
+	if ok {
+		cacheHits.WithLabelValues("package").Inc()
+	} else {
+		cacheMisses.WithLabelValues("package").Inc()
+		opts := append([]pack.LoadOption{pack.WithDigest(desc.Digest)}, r.LoadOptions...)
+		p, err = pack.Load(ctx, r.Fetcher, pkg, opts...)
+		if err != nil {
+			return nil, rev, err
+		}
+
+		data, err = p.Generate()
+		r.Cache.AddPackage(desc, p)
+		if err != nil {
+			return nil, rev, err
+		}
+	}
+
+	r.Cache.AddRendered(key, data)
+	rev.Revision = revision(data)
+	return data, rev, nil
+}
+
+// sync applies objs configured for server side apply, then syncs the rest with gitops-engine, returning the results of
+// the engine's sync
+func (r *KeviReconciler) sync(ctx context.Context, s syncer, objs []*unstructured.Unstructured, mark string, opts packagesv1alpha1.KeviSpecPackageSyncOptions) ([]common.ResourceSyncResult, error) {
 	l := log.FromContext(ctx)
 
-	result, err := r.Engine.Sync(ctx, objs, func(r *cache.Resource) bool {
+	var applied []*unstructured.Unstructured
+	ssaKeys := make(map[kube.ResourceKey]bool)
+	for _, obj := range objs {
+		if serverSideApplied(opts, obj) {
+			applied = append(applied, obj)
+			ssaKeys[kube.GetResourceKey(obj)] = true
+		}
+	}
+	if len(applied) > 0 {
+		if err := r.serverSideApply(ctx, s, applied, opts.Replace); err != nil {
+			return nil, err
+		}
+	}
+
+	// server side applied objects are still passed to the engine, but filtered from its sync, so they aren't pruned
+	syncOpts := append(engineSyncOpts(opts, ssaKeys), sync.WithLogr(l))
+	return s.engine.Sync(ctx, objs, isManaged(mark), "latest", syncNamespace, syncOpts...)
+}
+
+// gcMark uniquely identifies the resources belonging to a single package of a Kevi
+func gcMark(kevi *packagesv1alpha1.Kevi, pkg packagesv1alpha1.KeviSpecPackage) string {
+	return kevi.Namespace + "/" + kevi.Name + "/" + pkg.Name
+}
+
+func isManaged(mark string) func(r *cache.Resource) bool {
+	return func(r *cache.Resource) bool {
 		if r.Info != nil {
-			return r.Info.(*GCMark).Mark == "donk"
+			return r.Info.(*GCMark).Mark == mark
 		}
 		return false
-	}, "latest", "default", sync.WithPrune(true), sync.WithLogr(l))
-	if err != nil {
-		return err
 	}
+}
 
-	_ = result
-	return nil
+// revision identifies a package's rendered content
+func revision(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
 }
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kevi_cache_hits_total",
+		Help: "Number of package and render cache hits",
+	}, []string{"cache"})
+
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kevi_cache_misses_total",
+		Help: "Number of package and render cache misses",
+	}, []string{"cache"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheHits, cacheMisses)
+}
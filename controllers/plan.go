@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/argoproj/gitops-engine/pkg/cache"
+	"github.com/argoproj/gitops-engine/pkg/diff"
+	"github.com/argoproj/gitops-engine/pkg/sync"
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	resourceutil "github.com/argoproj/gitops-engine/pkg/sync/resource"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+// ApprovedPlanAnnotation approves syncing a Kevi's pending plan when set to the plan's hash
+const ApprovedPlanAnnotation = "kevi.cattle.io/approved-plan"
+
+// plan computes the changes syncing every package with a new revision would make, along with the revision of every
+// package the plan was computed from, the plan is nil when no package would change anything
+func (r *KeviReconciler) plan(ctx context.Context, kevi *packagesv1alpha1.Kevi, gate syncGate, cc cache.ClusterCache) (*packagesv1alpha1.KeviPlan, map[string]string, error) {
+	revisions := make(map[string]string)
+	plan := &packagesv1alpha1.KeviPlan{}
+
+	for _, pkg := range kevi.Spec.Packages {
+		rp, err := r.prepare(ctx, kevi, pkg, gate.pins[pkg.Name])
+		if err != nil {
+			return nil, nil, err
+		}
+		revisions[pkg.Name] = rp.rev.Revision
+
+		if prev := kevi.Status.PackageStatus(pkg.Name); prev != nil && prev.Revision == rp.rev.Revision && !gate.force {
+			continue
+		}
+
+		result, diffs, err := r.compare(ctx, cc, rp.objs, rp.mark, rp.rules)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pp := planPackage(pkg, rp.rev.Revision, result, diffs)
+		if len(pp.Created)+len(pp.Updated)+len(pp.Deleted) > 0 {
+			plan.Packages = append(plan.Packages, pp)
+		}
+	}
+
+	if len(plan.Packages) == 0 {
+		return nil, revisions, nil
+	}
+
+	data, err := json.Marshal(plan.Packages)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := sha256.Sum256(data)
+	plan.Hash = hex.EncodeToString(h[:])
+	return plan, revisions, nil
+}
+
+// planPackage sorts the diffs of a package's rendered and live objects into the resources a sync would create, update
+// and prune
+func planPackage(pkg packagesv1alpha1.KeviSpecPackage, revision string, result sync.ReconciliationResult, diffs *diff.DiffResultList) packagesv1alpha1.KeviPackagePlan {
+	pp := packagesv1alpha1.KeviPackagePlan{Name: pkg.Name, Revision: revision}
+	prune := pkg.SyncOptions.Prune == nil || *pkg.SyncOptions.Prune
+
+	for i, d := range diffs.Diffs {
+		target, live := result.Target[i], result.Live[i]
+		switch {
+		case target == nil:
+			if !prune || pruneExcluded(pkg.SyncOptions.PruneExclusions, live) ||
+				resourceutil.HasAnnotationOption(live, common.AnnotationSyncOptions, common.SyncOptionDisablePrune) {
+				continue
+			}
+			pp.Deleted = append(pp.Deleted, resourceStatus(live))
+		case live == nil:
+			pp.Created = append(pp.Created, resourceStatus(target))
+		case d.Modified:
+			pp.Updated = append(pp.Updated, resourceStatus(target))
+		}
+	}
+	return pp
+}
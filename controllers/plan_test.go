@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/cache/mocks"
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestPlanPackage(t *testing.T) {
+	kept := newConfigMap("kept", map[string]interface{}{"key": "value"})
+	kept.SetAnnotations(map[string]string{common.AnnotationSyncOptions: common.SyncOptionDisablePrune})
+
+	live := []*unstructured.Unstructured{
+		newConfigMap("unchanged", map[string]interface{}{"key": "value"}),
+		newConfigMap("updated", map[string]interface{}{"key": "old"}),
+		newConfigMap("removed", map[string]interface{}{"key": "value"}),
+		kept,
+	}
+	target := []*unstructured.Unstructured{
+		newConfigMap("unchanged", map[string]interface{}{"key": "value"}),
+		newConfigMap("updated", map[string]interface{}{"key": "new"}),
+		newConfigMap("created", map[string]interface{}{"key": "value"}),
+	}
+
+	liveObjs := make(map[kube.ResourceKey]*unstructured.Unstructured)
+	for _, obj := range live {
+		// live objects sharing a uid are deduplicated as the same resource
+		obj.SetUID(types.UID(obj.GetName()))
+		liveObjs[kube.GetResourceKey(obj)] = obj
+	}
+
+	cc := &mocks.ClusterCache{}
+	cc.On("GetManagedLiveObjs", mock.Anything, mock.Anything).Return(liveObjs, nil)
+	cc.On("IsNamespaced", mock.Anything).Return(true, nil)
+
+	r := &KeviReconciler{}
+	result, diffs, err := r.compare(context.Background(), cc, target, "mark", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := planPackage(packagesv1alpha1.KeviSpecPackage{Name: "pkg"}, "rev", result, diffs)
+
+	names := func(res []packagesv1alpha1.KeviResourceStatus) []string {
+		var n []string
+		for _, r := range res {
+			n = append(n, r.Name)
+		}
+		return n
+	}
+	for _, tt := range []struct {
+		name string
+		got  []string
+		want string
+	}{
+		{"created", names(pp.Created), "created"},
+		{"updated", names(pp.Updated), "updated"},
+		{"deleted", names(pp.Deleted), "removed"},
+	} {
+		if len(tt.got) != 1 || tt.got[0] != tt.want {
+			t.Errorf("planPackage() %s = %v, want [%s]", tt.name, tt.got, tt.want)
+		}
+	}
+
+	f := false
+	pkg := packagesv1alpha1.KeviSpecPackage{Name: "pkg", SyncOptions: packagesv1alpha1.KeviSpecPackageSyncOptions{Prune: &f}}
+	if pp := planPackage(pkg, "rev", result, diffs); len(pp.Deleted) != 0 {
+		t.Errorf("planPackage() deleted = %v with pruning disabled", names(pp.Deleted))
+	}
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"cattle.io/kevi/pkg/webhook"
+)
+
+// PullSecretReplicaLabel marks the copies of the airgap registry's pull secret kevi manages
+const PullSecretReplicaLabel = "kevi.cattle.io/pull-secret-replica"
+
+// PullSecretReconciler replicates the airgap registry's pull secret on demand, into the namespaces of pods the pod
+// relocator added it to. Replicas are kept until their namespace opts out of relocation or the source is deleted.
+type PullSecretReconciler struct {
+	client.Client
+
+	// Source is the pull secret that is replicated, copies keep its name
+	Source types.NamespacedName
+
+	// ExcludedNamespaces never get a copy of the pull secret, matching the pod relocator's
+	ExcludedNamespaces []string
+
+	// replicas reads replicas and relocated pods, and sources reads the source secret, from caches holding only those
+	// objects. They're set up with the manager, and Client is read instead when they're unset.
+	replicas client.Reader
+	sources  client.Reader
+}
+
+// Replicas are created and deleted with kevi-manager-pull-secret-role, which is only installed with a pull secret.
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+func (r *PullSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name == r.Source.Namespace {
+		return ctrl.Result{}, nil
+	}
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: req.Name}, &ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !ns.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	var replica corev1.Secret
+	exists := true
+	if err := r.replicaReader().Get(ctx, types.NamespacedName{Namespace: ns.Name, Name: r.Source.Name}, &replica); apierrors.IsNotFound(err) {
+		exists = false
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if exists && replica.Labels[PullSecretReplicaLabel] != "true" {
+		log.FromContext(ctx).Info("Not replacing a pull secret kevi doesn't manage", "namespace", ns.Name, "secret", r.Source.Name)
+		return ctrl.Result{}, nil
+	}
+
+	if r.excluded(ns) {
+		if exists {
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, &replica))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	var src corev1.Secret
+	if err := r.sourceReader().Get(ctx, r.Source, &src); apierrors.IsNotFound(err) {
+		// replicas of a deleted source are removed, they're recreated on demand if it's restored
+		if exists {
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, &replica))
+		}
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !exists {
+		requested, err := r.requested(ctx, ns.Name)
+		if err != nil || !requested {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// a secret's type can't be changed, so replicas of a source that changed type are recreated
+	if exists && replica.Type != src.Type {
+		if err := r.Delete(ctx, &replica); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		exists = false
+	}
+
+	if !exists {
+		replica = corev1.Secret{}
+		replica.Namespace = ns.Name
+		replica.Name = src.Name
+		replica.Labels = map[string]string{PullSecretReplicaLabel: "true"}
+		replica.Type = src.Type
+		replica.Data = src.Data
+		// the replica cache doesn't hold secrets kevi doesn't manage, they're found when creating the replica instead
+		err := r.Create(ctx, &replica)
+		if apierrors.IsAlreadyExists(err) {
+			log.FromContext(ctx).Info("Not replacing a pull secret kevi doesn't manage", "namespace", ns.Name, "secret", r.Source.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if reflect.DeepEqual(replica.Data, src.Data) {
+		return ctrl.Result{}, nil
+	}
+	replica.Data = src.Data
+	return ctrl.Result{}, r.Update(ctx, &replica)
+}
+
+// excluded returns true if pods in the namespace aren't relocated, so it doesn't need the pull secret
+func (r *PullSecretReconciler) excluded(ns corev1.Namespace) bool {
+	for _, e := range r.ExcludedNamespaces {
+		if ns.Name == e {
+			return true
+		}
+	}
+	return webhook.OptedOut(&ns)
+}
+
+// requested returns true if a relocated pod in the namespace was given the pull secret
+func (r *PullSecretReconciler) requested(ctx context.Context, namespace string) (bool, error) {
+	var pods corev1.PodList
+	if err := r.replicaReader().List(ctx, &pods, client.InNamespace(namespace), client.MatchingLabels{webhook.RelocatedLabel: "true"}); err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		if r.usesPullSecret(&pods.Items[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *PullSecretReconciler) usesPullSecret(pod *corev1.Pod) bool {
+	for _, s := range pod.Spec.ImagePullSecrets {
+		if s.Name == r.Source.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// namespacesFor maps a change of the source secret to the namespaces with a replica or that requested one, and a
+// change of a replica to its namespace
+func (r *PullSecretReconciler) namespacesFor(obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.Source.Namespace || obj.GetName() != r.Source.Name {
+		if obj.GetName() == r.Source.Name && obj.GetLabels()[PullSecretReplicaLabel] == "true" {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetNamespace()}}}
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	namespaces := make(map[string]bool)
+
+	var replicas corev1.SecretList
+	if err := r.replicaReader().List(ctx, &replicas, client.MatchingLabels{PullSecretReplicaLabel: "true"}); err != nil {
+		return nil
+	}
+	for _, s := range replicas.Items {
+		namespaces[s.Namespace] = true
+	}
+
+	var pods corev1.PodList
+	if err := r.replicaReader().List(ctx, &pods, client.MatchingLabels{webhook.RelocatedLabel: "true"}); err != nil {
+		return nil
+	}
+	for i := range pods.Items {
+		if r.usesPullSecret(&pods.Items[i]) {
+			namespaces[pods.Items[i].Namespace] = true
+		}
+	}
+
+	var reqs []reconcile.Request
+	for ns := range namespaces {
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: ns}})
+	}
+	return reqs
+}
+
+// namespaceOfPod maps a pod given the pull secret to its namespace
+func (r *PullSecretReconciler) namespaceOfPod(obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || !r.usesPullSecret(pod) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: pod.Namespace}}}
+}
+
+func (r *PullSecretReconciler) replicaReader() client.Reader {
+	if r.replicas != nil {
+		return r.replicas
+	}
+	return r.Client
+}
+
+func (r *PullSecretReconciler) sourceReader() client.Reader {
+	if r.sources != nil {
+		return r.sources
+	}
+	return r.Client
+}
+
+// SetupWithManager sets up the controller with the Manager. Watching secrets and pods through the manager's cache
+// would hold every one in the cluster, so the controller keeps its own caches of the replicas and relocated pods, and
+// of the source secret.
+func (r *PullSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	replicas, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Secret{}: {Label: labels.SelectorFromSet(labels.Set{PullSecretReplicaLabel: "true"})},
+			&corev1.Pod{}:    {Label: labels.SelectorFromSet(labels.Set{webhook.RelocatedLabel: "true"})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sources, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: r.Source.Namespace,
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Secret{}: {Field: fields.OneTermEqualSelector("metadata.name", r.Source.Name)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range []cache.Cache{replicas, sources} {
+		if err := mgr.Add(c); err != nil {
+			return err
+		}
+	}
+	r.replicas, r.sources = replicas, sources
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pullsecret").
+		For(&corev1.Namespace{}).
+		Watches(source.NewKindWithCache(&corev1.Secret{}, replicas), handler.EnqueueRequestsFromMapFunc(r.namespacesFor)).
+		Watches(source.NewKindWithCache(&corev1.Secret{}, sources), handler.EnqueueRequestsFromMapFunc(r.namespacesFor)).
+		Watches(source.NewKindWithCache(&corev1.Pod{}, replicas), handler.EnqueueRequestsFromMapFunc(r.namespaceOfPod)).
+		Complete(r)
+}
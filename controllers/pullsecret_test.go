@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"cattle.io/kevi/pkg/webhook"
+)
+
+func TestPullSecretReconciler(t *testing.T) {
+	ctx := context.Background()
+	source := types.NamespacedName{Namespace: "kevi-system", Name: "airgap"}
+	secret := func(namespace string, data string, replica bool) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: source.Name},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(data)},
+		}
+		if replica {
+			s.Labels = map[string]string{PullSecretReplicaLabel: "true"}
+		}
+		return s
+	}
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	pod := func(namespace string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app", Labels: map[string]string{webhook.RelocatedLabel: "true"}},
+			Spec:       corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: source.Name}}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		objs      []client.Object
+		noSource  bool
+		wantData  string
+	}{
+		{
+			name:      "replicates into a namespace of a relocated pod",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", nil), pod("apps")},
+			wantData:  "v2",
+		},
+		{
+			name:      "skips namespaces without relocated pods",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", nil)},
+		},
+		{
+			name:      "skips pods that weren't relocated",
+			namespace: "apps",
+			objs: []client.Object{namespace("apps", nil), &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app"},
+				Spec:       corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: source.Name}}},
+			}},
+		},
+		{
+			name:      "updates a rotated replica",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", nil), secret("apps", "v1", true)},
+			wantData:  "v2",
+		},
+		{
+			name:      "skips excluded namespaces",
+			namespace: "kube-system",
+			objs:      []client.Object{namespace("kube-system", nil), pod("kube-system")},
+		},
+		{
+			name:      "deletes replicas of a deleted source",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", nil), pod("apps"), secret("apps", "v1", true)},
+			noSource:  true,
+		},
+		{
+			name:      "deletes replicas of opted out namespaces",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", map[string]string{webhook.RelocateOptOut: "false"}), secret("apps", "v1", true)},
+		},
+		{
+			name:      "leaves secrets kevi doesn't manage",
+			namespace: "apps",
+			objs:      []client.Object{namespace("apps", nil), secret("apps", "mine", false)},
+			wantData:  "mine",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := append([]client.Object{namespace(source.Namespace, nil)}, tt.objs...)
+			if !tt.noSource {
+				objs = append(objs, secret(source.Namespace, "v2", false))
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+
+			r := &PullSecretReconciler{Client: c, Source: source, ExcludedNamespaces: webhook.DefaultExcludedNamespaces}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: tt.namespace}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var got corev1.Secret
+			err := c.Get(ctx, types.NamespacedName{Namespace: tt.namespace, Name: source.Name}, &got)
+			switch {
+			case tt.wantData == "" && !apierrors.IsNotFound(err):
+				t.Errorf("Reconcile() left a replica, error = %v", err)
+			case tt.wantData != "" && err != nil:
+				t.Errorf("Reconcile() didn't replicate the secret, error = %v", err)
+			case tt.wantData != "" && string(got.Data[corev1.DockerConfigJsonKey]) != tt.wantData:
+				t.Errorf("Reconcile() replica data = %s, want %s", got.Data[corev1.DockerConfigJsonKey], tt.wantData)
+			}
+		})
+	}
+}
+
+func TestPullSecretReconciler_unmanagedOutsideCache(t *testing.T) {
+	ctx := context.Background()
+	source := types.NamespacedName{Namespace: "kevi-system", Name: "airgap"}
+	mine := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: source.Name},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("mine")},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app", Labels: map[string]string{webhook.RelocatedLabel: "true"}},
+		Spec:       corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: source.Name}}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: source.Namespace, Name: source.Name}},
+		mine, pod,
+	).Build()
+
+	// the replica cache only holds labelled secrets and relocated pods
+	replicas := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pod).Build()
+	r := &PullSecretReconciler{Client: c, Source: source, replicas: replicas}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "apps"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var got corev1.Secret
+	if err := c.Get(ctx, client.ObjectKeyFromObject(mine), &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Data[corev1.DockerConfigJsonKey]) != "mine" || got.Labels[PullSecretReplicaLabel] != "" {
+		t.Errorf("Reconcile() replaced a secret kevi doesn't manage, got = %+v", got)
+	}
+}
+
+func TestPullSecretReconciler_namespacesFor(t *testing.T) {
+	source := types.NamespacedName{Namespace: "kevi-system", Name: "airgap"}
+	replica := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "airgap", Labels: map[string]string{PullSecretReplicaLabel: "true"}}}
+	relocated := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "job", Labels: map[string]string{webhook.RelocatedLabel: "true"}},
+		Spec:       corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: source.Name}}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kevi-system"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "jobs"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "app"}},
+		replica, relocated,
+	).Build()
+	r := &PullSecretReconciler{Client: c, Source: source}
+
+	got := r.namespacesFor(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kevi-system", Name: "airgap"}})
+	sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+	if len(got) != 2 || got[0].Name != "apps" || got[1].Name != "jobs" {
+		t.Errorf("namespacesFor() source = %v, want the namespaces with a replica or relocated pod", got)
+	}
+
+	if got := r.namespaceOfPod(relocated); len(got) != 1 || got[0].Name != "jobs" {
+		t.Errorf("namespaceOfPod() = %v, want its namespace", got)
+	}
+	if got := r.namespaceOfPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "app"}}); len(got) != 0 {
+		t.Errorf("namespaceOfPod() without the pull secret = %v, want none", got)
+	}
+	if got := r.namespacesFor(replica); len(got) != 1 || got[0].Name != "apps" {
+		t.Errorf("namespacesFor() replica = %v, want its namespace", got)
+	}
+
+	if got := r.namespacesFor(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "other"}}); len(got) != 0 {
+		t.Errorf("namespacesFor() unrelated secret = %v, want none", got)
+	}
+}
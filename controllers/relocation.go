@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"github.com/argoproj/gitops-engine/pkg/diff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	"cattle.io/kevi/pkg/pack"
+	"cattle.io/kevi/pkg/webhook"
+)
+
+var (
+	_ diff.Normalizer = normalizers{}
+	_ diff.Normalizer = &relocationNormalizer{}
+)
+
+// imageRulePaths returns the image paths of the image rules matching a kind, resolved to its resource by the
+// controller's own cluster, where the pod relocating webhook runs
+func (r *KeviReconciler) imageRulePaths(gvk schema.GroupVersionKind) []string {
+	if len(r.ImageRules) == 0 || r.Client == nil {
+		return nil
+	}
+
+	mapping, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, rule := range r.ImageRules {
+		if rule.GroupResource == mapping.Resource.GroupResource() {
+			paths = append(paths, rule.Paths...)
+		}
+	}
+	return paths
+}
+
+// normalizers normalizes objects with each normalizer in order
+type normalizers []diff.Normalizer
+
+func (ns normalizers) Normalize(un *unstructured.Unstructured) error {
+	for _, n := range ns {
+		if err := n.Normalize(un); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relocationNormalizer restores the images the pod relocating webhook relocated at the image rules' paths to their
+// original reference, so resources it rewrote at admission aren't compared as drifted
+type relocationNormalizer struct {
+	paths func(gvk schema.GroupVersionKind) []string
+}
+
+func (n *relocationNormalizer) Normalize(un *unstructured.Unstructured) error {
+	if un == nil {
+		return nil
+	}
+
+	recorded, ok := un.GetAnnotations()[webhook.OriginalImagesAnnotation]
+	if !ok {
+		return nil
+	}
+
+	paths := n.paths(un.GroupVersionKind())
+	if len(paths) == 0 {
+		return nil
+	}
+
+	var original map[string]string
+	if err := json.Unmarshal([]byte(recorded), &original); err != nil {
+		return nil
+	}
+
+	pack.RewriteImages(un.Object, paths, func(image string) string {
+		if o, ok := original[image]; ok {
+			return o
+		}
+		return image
+	})
+
+	annotations := un.GetAnnotations()
+	delete(annotations, webhook.OriginalImagesAnnotation)
+	un.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/cache/mocks"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"cattle.io/kevi/pkg/webhook"
+)
+
+var prometheusGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "Prometheus"}
+
+func newImageRuleReconciler(t *testing.T) *KeviReconciler {
+	rule, err := webhook.ParseImageRule("prometheuses.monitoring.coreos.com={.spec.image}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(prometheusGVK, meta.RESTScopeNamespace)
+	return &KeviReconciler{
+		Client:     fake.NewClientBuilder().WithRESTMapper(mapper).Build(),
+		ImageRules: []webhook.ImageRule{rule},
+	}
+}
+
+func newPrometheus(image string, annotations map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "prometheus",
+			"namespace":   "default",
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{"image": image},
+	}}
+	u.SetGroupVersionKind(prometheusGVK)
+	return u
+}
+
+func TestKeviReconciler_imageRulePaths(t *testing.T) {
+	r := newImageRuleReconciler(t)
+
+	if got := r.imageRulePaths(prometheusGVK); !reflect.DeepEqual(got, []string{"{.spec.image}"}) {
+		t.Errorf("imageRulePaths() = %v, want the rule's paths", got)
+	}
+	if got := r.imageRulePaths(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}); len(got) != 0 {
+		t.Errorf("imageRulePaths() of an unmatched kind = %v, want none", got)
+	}
+}
+
+func TestKeviReconciler_driftRelocatedByWebhook(t *testing.T) {
+	original := map[string]interface{}{
+		webhook.OriginalImagesAnnotation: `{"registry.local/prometheus/prometheus:v2.0.0":"quay.io/prometheus/prometheus:v2.0.0"}`,
+	}
+	target := newPrometheus("quay.io/prometheus/prometheus:v2.0.0", nil)
+
+	tests := []struct {
+		name string
+		live *unstructured.Unstructured
+		want int
+	}{
+		{
+			name: "relocated by the webhook",
+			live: newPrometheus("registry.local/prometheus/prometheus:v2.0.0", original),
+		},
+		{
+			name: "modified after relocation",
+			live: newPrometheus("registry.local/prometheus/prometheus:v2.1.0", original),
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := map[kube.ResourceKey]*unstructured.Unstructured{kube.GetResourceKey(tt.live): tt.live}
+
+			cc := &mocks.ClusterCache{}
+			cc.On("GetManagedLiveObjs", mock.Anything, mock.Anything).Return(live, nil)
+			cc.On("IsNamespaced", mock.Anything).Return(true, nil)
+
+			r := newImageRuleReconciler(t)
+			got, err := r.drift(context.Background(), cc, []*unstructured.Unstructured{target.DeepCopy()}, "default/kevi/pkg", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("drift() got %d drifted resources, want %d: %v", len(got), tt.want, got)
+			}
+		})
+	}
+}
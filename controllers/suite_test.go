@@ -41,6 +41,10 @@ var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
 
+// remoteEnv is a second API server, targeted by Kevis as a remote cluster
+var remoteCfg *rest.Config
+var remoteEnv *envtest.Environment
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -71,10 +75,19 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("bootstrapping remote test environment")
+	remoteEnv = &envtest.Environment{}
+
+	remoteCfg, err = remoteEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(remoteCfg).NotTo(BeNil())
+
 }, 60)
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
+	err = remoteEnv.Stop()
+	Expect(err).NotTo(HaveOccurred())
 })
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/sync"
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+const (
+	// SyncOptionsAnnotation is a comma separated list of per resource sync options, such as Prune=false or
+	// ServerSideApply=true, overriding the package's syncOptions
+	SyncOptionsAnnotation = "kevi.cattle.io/sync-options"
+
+	syncOptionServerSideApply        = "ServerSideApply=true"
+	syncOptionDisableServerSideApply = "ServerSideApply=false"
+)
+
+// translateSyncOptions copies kevi sync options annotations onto the equivalent gitops-engine annotation
+func translateSyncOptions(objs []*unstructured.Unstructured) {
+	for _, obj := range objs {
+		annotations := obj.GetAnnotations()
+		opts := splitOptions(annotations[SyncOptionsAnnotation])
+		if len(opts) == 0 {
+			continue
+		}
+
+		merged := splitOptions(annotations[common.AnnotationSyncOptions])
+		for _, o := range opts {
+			// server side apply is handled by kevi, not gitops-engine
+			if o == syncOptionServerSideApply || o == syncOptionDisableServerSideApply {
+				continue
+			}
+			if !hasOption(merged, o) {
+				merged = append(merged, o)
+			}
+		}
+		if len(merged) > 0 {
+			annotations[common.AnnotationSyncOptions] = strings.Join(merged, ",")
+			obj.SetAnnotations(annotations)
+		}
+	}
+}
+
+// serverSideApplied returns true if obj is applied with server side apply instead of gitops-engine
+func serverSideApplied(opts packagesv1alpha1.KeviSpecPackageSyncOptions, obj *unstructured.Unstructured) bool {
+	annotated := splitOptions(obj.GetAnnotations()[SyncOptionsAnnotation])
+	switch {
+	case hasOption(annotated, syncOptionServerSideApply):
+		return true
+	case hasOption(annotated, syncOptionDisableServerSideApply):
+		return false
+	}
+	return opts.ServerSideApply
+}
+
+// engineSyncOpts maps a package's sync options onto gitops-engine sync options
+func engineSyncOpts(opts packagesv1alpha1.KeviSpecPackageSyncOptions, ssaKeys map[kube.ResourceKey]bool) []sync.SyncOpt {
+	prune := opts.Prune == nil || *opts.Prune
+	validate := opts.Validate == nil || *opts.Validate
+
+	syncOpts := []sync.SyncOpt{
+		sync.WithPrune(prune),
+		sync.WithPruneLast(opts.PruneLast),
+		sync.WithReplace(opts.Replace),
+		sync.WithManifestValidation(validate),
+	}
+
+	if len(opts.PruneExclusions) > 0 || len(ssaKeys) > 0 {
+		// gitops-engine passes the live object before the target, despite how the filter's signature is named
+		syncOpts = append(syncOpts, sync.WithResourcesFilter(func(key kube.ResourceKey, live *unstructured.Unstructured, target *unstructured.Unstructured) bool {
+			if target != nil {
+				return !ssaKeys[key]
+			}
+			return live == nil || !pruneExcluded(opts.PruneExclusions, live)
+		}))
+	}
+
+	return syncOpts
+}
+
+// pruneExcluded returns true if obj matches any of the package's prune exclusions
+func pruneExcluded(exclusions []packagesv1alpha1.KeviResourceSelector, obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	for _, e := range exclusions {
+		if e.Matches(gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverSideApply applies objs with server side apply, defaulting the namespace of namespaced resources
+func (r *KeviReconciler) serverSideApply(ctx context.Context, s syncer, objs []*unstructured.Unstructured, replace bool) error {
+	if s.resources == nil {
+		return fmt.Errorf("server side apply requested for %d resources but no resource manager is configured", len(objs))
+	}
+
+	for _, obj := range objs {
+		if obj.GetNamespace() != "" || s.cache == nil {
+			continue
+		}
+		namespaced, err := s.cache.IsNamespaced(obj.GroupVersionKind().GroupKind())
+		if err != nil {
+			return err
+		}
+		if namespaced {
+			obj.SetNamespace(syncNamespace)
+		}
+	}
+
+	opts := ssa.DefaultApplyOptions()
+	opts.Force = replace
+	_, err := s.resources.ApplyAllStaged(ctx, objs, opts)
+	return err
+}
+
+func splitOptions(s string) []string {
+	var opts []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			opts = append(opts, o)
+		}
+	}
+	return opts
+}
+
+func hasOption(opts []string, o string) bool {
+	for _, opt := range opts {
+		if opt == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestTranslateSyncOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			name: "no options",
+		},
+		{
+			name:        "translated",
+			annotations: map[string]string{SyncOptionsAnnotation: "Prune=false, Replace=true"},
+			want:        "Prune=false,Replace=true",
+		},
+		{
+			name: "merged with existing",
+			annotations: map[string]string{
+				SyncOptionsAnnotation:        "Prune=false,Validate=false",
+				common.AnnotationSyncOptions: "Validate=false",
+			},
+			want: "Validate=false,Prune=false",
+		},
+		{
+			name:        "server side apply is not translated",
+			annotations: map[string]string{SyncOptionsAnnotation: "ServerSideApply=true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newDeployment(1, "app")
+			obj.SetAnnotations(tt.annotations)
+
+			translateSyncOptions([]*unstructured.Unstructured{obj})
+
+			if got := obj.GetAnnotations()[common.AnnotationSyncOptions]; got != tt.want {
+				t.Errorf("translateSyncOptions() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerSideApplied(t *testing.T) {
+	tests := []struct {
+		name       string
+		pkgSSA     bool
+		annotation string
+		want       bool
+	}{
+		{name: "disabled"},
+		{name: "package", pkgSSA: true, want: true},
+		{name: "annotation", annotation: "ServerSideApply=true", want: true},
+		{name: "annotation overrides package", pkgSSA: true, annotation: "Prune=false,ServerSideApply=false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newDeployment(1, "app")
+			obj.SetAnnotations(map[string]string{SyncOptionsAnnotation: tt.annotation})
+
+			opts := packagesv1alpha1.KeviSpecPackageSyncOptions{ServerSideApply: tt.pkgSSA}
+			if got := serverSideApplied(opts, obj); got != tt.want {
+				t.Errorf("serverSideApplied() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneExcluded(t *testing.T) {
+	tests := []struct {
+		name       string
+		exclusions []packagesv1alpha1.KeviResourceSelector
+		want       bool
+	}{
+		{name: "none"},
+		{name: "kind", exclusions: []packagesv1alpha1.KeviResourceSelector{{Group: "apps", Kind: "Deployment"}}, want: true},
+		{name: "name", exclusions: []packagesv1alpha1.KeviResourceSelector{{Group: "apps", Kind: "Deployment", Name: "app"}}, want: true},
+		{name: "other name", exclusions: []packagesv1alpha1.KeviResourceSelector{{Group: "apps", Kind: "Deployment", Name: "other"}}},
+		{name: "other group", exclusions: []packagesv1alpha1.KeviResourceSelector{{Kind: "Deployment"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pruneExcluded(tt.exclusions, newDeployment(1, "app")); got != tt.want {
+				t.Errorf("pruneExcluded() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+const (
+	// ReconcileRequestedAtAnnotation requests an immediate sync of every package when its value changes
+	ReconcileRequestedAtAnnotation = "kevi.cattle.io/reconcile-requested-at"
+
+	// windowRequeue is how often Kevis blocked by a sync window are checked again
+	windowRequeue = time.Minute
+)
+
+// syncRequest returns the value of the Kevi's reconcile request annotation, and whether it is yet to be handled
+func syncRequest(kevi *packagesv1alpha1.Kevi) (string, bool) {
+	requested, ok := kevi.GetAnnotations()[ReconcileRequestedAtAnnotation]
+	return requested, ok && requested != kevi.Status.LastHandledReconcileAt
+}
+
+// syncBlocked returns the reason syncing is blocked by the given windows at now, or an empty string if it's allowed
+func syncBlocked(windows []packagesv1alpha1.KeviSyncWindow, now time.Time, manual bool) (string, error) {
+	var (
+		allows      int
+		allowActive bool
+		allowManual bool
+	)
+
+	for _, w := range windows {
+		active, err := windowActive(w, now)
+		if err != nil {
+			return "", err
+		}
+
+		switch w.Kind {
+		case packagesv1alpha1.KeviSyncWindowDeny:
+			if active && !(manual && w.ManualSync) {
+				return fmt.Sprintf("deny window %q is active", w.Schedule), nil
+			}
+		case packagesv1alpha1.KeviSyncWindowAllow:
+			allows++
+			allowActive = allowActive || active
+			allowManual = allowManual || w.ManualSync
+		default:
+			return "", fmt.Errorf("unknown sync window kind %q", w.Kind)
+		}
+	}
+
+	if allows > 0 && !allowActive && !(manual && allowManual) {
+		return "no allow window is active", nil
+	}
+	return "", nil
+}
+
+// windowActive returns true if the window opened within its duration before now
+func windowActive(w packagesv1alpha1.KeviSyncWindow, now time.Time) (bool, error) {
+	schedule, err := cron.ParseStandard(w.Schedule)
+	if err != nil {
+		return false, fmt.Errorf("invalid sync window schedule %q: %w", w.Schedule, err)
+	}
+
+	opened := schedule.Next(now.Add(-w.Duration.Duration))
+	return !opened.After(now), nil
+}
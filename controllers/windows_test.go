@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
+)
+
+func TestSyncBlocked(t *testing.T) {
+	// 10:30 UTC on a Wednesday
+	now := time.Date(2021, 12, 1, 10, 30, 0, 0, time.UTC)
+
+	window := func(kind, schedule string, d time.Duration, manual bool) packagesv1alpha1.KeviSyncWindow {
+		return packagesv1alpha1.KeviSyncWindow{Kind: kind, Schedule: schedule, Duration: metav1.Duration{Duration: d}, ManualSync: manual}
+	}
+
+	tests := []struct {
+		name        string
+		windows     []packagesv1alpha1.KeviSyncWindow
+		manual      bool
+		wantBlocked bool
+		wantErr     bool
+	}{
+		{
+			name: "no windows",
+		},
+		{
+			name:    "inside allow window",
+			windows: []packagesv1alpha1.KeviSyncWindow{window("allow", "0 10 * * *", time.Hour, false)},
+		},
+		{
+			name:        "outside allow window",
+			windows:     []packagesv1alpha1.KeviSyncWindow{window("allow", "0 12 * * *", time.Hour, false)},
+			wantBlocked: true,
+		},
+		{
+			name:    "outside allow window with manual sync",
+			windows: []packagesv1alpha1.KeviSyncWindow{window("allow", "0 12 * * *", time.Hour, true)},
+			manual:  true,
+		},
+		{
+			name:        "inside deny window",
+			windows:     []packagesv1alpha1.KeviSyncWindow{window("deny", "0 10 * * 3", 2*time.Hour, false)},
+			wantBlocked: true,
+		},
+		{
+			name:        "manual sync inside deny window without manual sync",
+			windows:     []packagesv1alpha1.KeviSyncWindow{window("deny", "0 10 * * 3", 2*time.Hour, false)},
+			manual:      true,
+			wantBlocked: true,
+		},
+		{
+			name:    "manual sync inside deny window",
+			windows: []packagesv1alpha1.KeviSyncWindow{window("deny", "0 10 * * 3", 2*time.Hour, true)},
+			manual:  true,
+		},
+		{
+			name:        "deny wins over allow",
+			windows:     []packagesv1alpha1.KeviSyncWindow{window("allow", "* * * * *", time.Hour, false), window("deny", "0 10 * * *", time.Hour, false)},
+			wantBlocked: true,
+		},
+		{
+			name:    "invalid schedule",
+			windows: []packagesv1alpha1.KeviSyncWindow{window("deny", "not a schedule", time.Hour, false)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := syncBlocked(tt.windows, now, tt.manual)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncBlocked() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != "") != tt.wantBlocked {
+				t.Errorf("syncBlocked() got = %q, wantBlocked %v", got, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestSyncRequest(t *testing.T) {
+	kevi := &packagesv1alpha1.Kevi{}
+	if _, ok := syncRequest(kevi); ok {
+		t.Errorf("syncRequest() requested without an annotation")
+	}
+
+	kevi.SetAnnotations(map[string]string{ReconcileRequestedAtAnnotation: "now"})
+	if got, ok := syncRequest(kevi); !ok || got != "now" {
+		t.Errorf("syncRequest() got = %q, %v, want now, true", got, ok)
+	}
+
+	kevi.Status.LastHandledReconcileAt = "now"
+	if _, ok := syncRequest(kevi); ok {
+		t.Errorf("syncRequest() requested after the request was handled")
+	}
+}
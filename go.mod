@@ -3,6 +3,8 @@ module cattle.io/kevi
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.4.1
+	github.com/Masterminds/semver/v3 v3.1.1
 	github.com/argoproj/gitops-engine v0.5.1
 	github.com/fluxcd/pkg/ssa v0.7.0
 	github.com/go-logr/logr v1.2.0
@@ -11,10 +13,16 @@ require (
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.17.0
 	github.com/open-policy-agent/cert-controller v0.2.0
+	github.com/opencontainers/go-digest v1.0.0
 	github.com/opencontainers/image-spec v1.0.2
+	github.com/prometheus/client_golang v1.11.0
 	github.com/rancherfederal/ocil v0.1.4
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/zerolog v1.26.1
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	helm.sh/helm/v3 v3.6.1-0.20211207164812-8ca401398d8b
 	k8s.io/api v0.23.0
 	k8s.io/apimachinery v0.23.0
@@ -519,7 +519,7 @@ func addCopy(parent *cobra.Command) {
 				PlainHTTP: plainHttp,
 			}
 
-			descs, err := s.CopyAll(ctx, args[0], ropts)
+			descs, err := s.CopyAll(ctx, args[0], ropts, pack.RelocateRepository)
 			if err != nil {
 				return err
 			}
@@ -678,7 +678,7 @@ func initControllers(mgr ctrl.Manager, reconciler *controllers.KeviReconciler, r
 		os.Exit(1)
 	}
 
-	if err := webhook.AddPodRelocatorToManager(mgr, registry); err != nil {
+	if err := webhook.AddPodRelocatorToManager(mgr, registry, reconciler.RelocationStrategy); err != nil {
 		setupLog.Error(err, "failed to register pod relocator webhook")
 		os.Exit(1)
 	}
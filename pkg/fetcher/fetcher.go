@@ -3,6 +3,7 @@ package fetcher
 import (
 	"context"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/pkg/target"
 
@@ -10,7 +11,31 @@ import (
 )
 
 type Fetcher interface {
-	Fetch(ctx context.Context, to target.Target, pkg v1alpha1.KeviSpecPackage) ([]v1.Descriptor, error)
+	Fetch(ctx context.Context, to target.Target, pkg v1alpha1.KeviSpecPackage, opts ...Option) ([]v1.Descriptor, error)
+
+	// Resolve returns the root descriptor of a package without fetching any of its content
+	Resolve(ctx context.Context, pkg v1alpha1.KeviSpecPackage) (v1.Descriptor, error)
 
 	Locate(pkg v1alpha1.KeviSpecPackage) string
 }
+
+type Option func(*options)
+
+type options struct {
+	digest digest.Digest
+}
+
+// WithDigest pins a fetch to a specific package digest instead of the package's tag
+func WithDigest(d digest.Digest) Option {
+	return func(o *options) {
+		o.digest = d
+	}
+}
+
+func makeOptions(opts ...Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
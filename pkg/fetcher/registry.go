@@ -46,12 +46,21 @@ func NewRegistry(hostname string, opts content.RegistryOptions) (*registry, erro
 	}, nil
 }
 
-func (r *registry) Fetch(ctx context.Context, to target.Target, pkg v1alpha1.KeviSpecPackage) ([]v1.Descriptor, error) {
+func (r *registry) Fetch(ctx context.Context, to target.Target, pkg v1alpha1.KeviSpecPackage, opts ...Option) ([]v1.Descriptor, error) {
 	var (
+		o      = makeOptions(opts...)
 		ref    = r.Locate(pkg)
 		ldescs []v1.Descriptor
 	)
 
+	if o.digest != "" {
+		refn, err := name.ParseReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		ref = refn.Context().Digest(o.digest.String()).Name()
+	}
+
 	mt, err := r.contentMediaType(pkg)
 	if err != nil {
 		return nil, err
@@ -69,6 +78,11 @@ func (r *registry) Fetch(ctx context.Context, to target.Target, pkg v1alpha1.Kev
 	return ldescs, nil
 }
 
+func (r *registry) Resolve(ctx context.Context, pkg v1alpha1.KeviSpecPackage) (v1.Descriptor, error) {
+	_, desc, err := r.store.Resolve(ctx, r.Locate(pkg))
+	return desc, err
+}
+
 func (r *registry) Locate(pkg v1alpha1.KeviSpecPackage) string {
 	ref := path.Join(r.Hostname, DefaultRepositoryNamespace, pkg.Name)
 	refn, err := name.ParseReference(ref)
@@ -0,0 +1,93 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ControllerRepository is the repository of the registry the controller's image is pushed to
+	ControllerRepository = "kevi/kevi-controller"
+
+	// ManifestsFile and ImageLayout are where Export writes the manifests and the controller's image
+	ManifestsFile = "kevi.yaml"
+	ImageLayout   = "kevi-controller"
+)
+
+// Export writes the manifests installing kevi with opts, and the controller's image as an OCI layout, to dir, so kevi
+// can be installed by applying the manifests once the image is pushed to opts.Registry. The image is a multi-arch
+// index when there are binaries, otherwise it's built from the executed binary, and the manifests reference it by
+// digest, which is returned.
+func Export(ctx context.Context, dir string, opts Options, binaries []Binary) (name.Digest, error) {
+	repon, err := name.NewRepository(ControllerRepository, name.WithDefaultRegistry(opts.Registry))
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return name.Digest{}, err
+	}
+	p, err := layout.Write(filepath.Join(dir, ImageLayout), empty.Index)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	var refn name.Digest
+	if len(binaries) > 0 {
+		idx, err := BuildIndex(ctx, binaries)
+		if err != nil {
+			return name.Digest{}, err
+		}
+		h, err := idx.Digest()
+		if err != nil {
+			return name.Digest{}, err
+		}
+
+		refn = repon.Digest(h.String())
+		if err := p.AppendIndex(idx, layout.WithAnnotations(map[string]string{ocispec.AnnotationRefName: refn.Name()})); err != nil {
+			return name.Digest{}, err
+		}
+	} else {
+		img, err := Build(ctx)
+		if err != nil {
+			return name.Digest{}, err
+		}
+		h, err := img.Digest()
+		if err != nil {
+			return name.Digest{}, err
+		}
+
+		refn = repon.Digest(h.String())
+		if err := p.AppendImage(img, layout.WithAnnotations(map[string]string{ocispec.AnnotationRefName: refn.Name()})); err != nil {
+			return name.Digest{}, err
+		}
+	}
+	opts.Image = refn.Name()
+
+	objs, err := Generate(ctx, opts)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	var b bytes.Buffer
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return name.Digest{}, err
+		}
+		b.WriteString("---\n")
+		b.Write(data)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestsFile), b.Bytes(), 0o644); err != nil {
+		return name.Digest{}, err
+	}
+	return refn, nil
+}
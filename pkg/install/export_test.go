@@ -0,0 +1,54 @@
+package install
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	opts := MakeDefaultOptions()
+	opts.Registry = "registry.airgap:5000"
+
+	binaries := []Binary{{
+		Platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("kevi")), nil
+		},
+	}}
+
+	refn, err := Export(context.Background(), dir, opts, binaries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refn.Context().Name(); got != "registry.airgap:5000/"+ControllerRepository {
+		t.Errorf("Export() repository = %s, want the controller repository of the registry", got)
+	}
+
+	manifests, err := os.ReadFile(filepath.Join(dir, ManifestsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifests), "image: "+refn.Name()) {
+		t.Errorf("Export() manifests don't reference the image %s", refn.Name())
+	}
+
+	idx, err := layout.ImageIndexFromPath(filepath.Join(dir, ImageLayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Manifests) != 1 || m.Manifests[0].Digest.String() != refn.DigestStr() {
+		t.Errorf("Export() layout = %+v, want only %s", m.Manifests, refn.DigestStr())
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	goruntime "runtime"
+	"strings"
 	"text/template"
 
 	"github.com/argoproj/gitops-engine/pkg/utils/kube"
@@ -19,8 +20,14 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"cattle.io/kevi/pkg/webhook"
 )
 
 // Cheat quite a bit here, TODO: properly template this without so much work on the frontend
@@ -34,16 +41,72 @@ type Options struct {
 	Namespace string
 	Registry  string
 	Image     string
+
+	// RequireServiceAccount installs the manager without cluster-wide write access, requiring every Kevi to sync as
+	// its own service account
+	RequireServiceAccount bool
+
+	// RelocationStrategy is how the manager maps images to registry repositories, matching how they were relocated
+	RelocationStrategy string
+
+	// ExcludedNamespaces are never matched by the pod relocating webhook
+	ExcludedNamespaces []string
+
+	// PullSecret is a Secret in the manager's namespace with credentials for the registry, replicated into the
+	// namespaces of relocated pods. Setting it grants the manager creating and deleting secrets in every namespace.
+	PullSecret string
+
+	// ImageRules relocate the images of resources other than pods, each adding its resource to the mutating webhook
+	ImageRules []webhook.ImageRule
+
+	// Replicas of the manager, which elect a leader when there's more than one
+	Replicas int32
+
+	Resources         corev1.ResourceRequirements
+	NodeSelector      map[string]string
+	Tolerations       []corev1.Toleration
+	PriorityClassName string
+
+	// PodDisruptionBudget limits voluntary disruptions of the manager to one replica at a time
+	PodDisruptionBudget bool
+
+	// Version of kevi being installed, recorded on the manager to detect upgrades. It's set by the caller, which knows
+	// the version it was built as.
+	Version string
 }
 
 func MakeDefaultOptions() Options {
 	return Options{
-		Registry: "ghcr.io",
+		Namespace:          "kevi-system",
+		Registry:           "ghcr.io",
+		ExcludedNamespaces: webhook.DefaultExcludedNamespaces,
+		Replicas:           1,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
 	}
 }
 
+var funcs = template.FuncMap{
+	"toYaml": func(v interface{}) (string, error) {
+		data, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+	"nindent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return "\n" + pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+}
+
 func Generate(ctx context.Context, opts Options) ([]*unstructured.Unstructured, error) {
-	t, err := template.New("tmpl").Parse(gen)
+	t, err := template.New("tmpl").Funcs(funcs).Parse(gen)
 	if err != nil {
 		return nil, err
 	}
@@ -65,20 +128,67 @@ func Generate(ctx context.Context, opts Options) ([]*unstructured.Unstructured,
 // TODO: Should we keep distroless:scratch as the base? we could embed the layer (777k) into the binary...
 // 		 Benefit with distroless:scratch is we get CA's
 func Build(ctx context.Context) (v1.Image, error) {
-	epath, err := os.Executable()
+	b, err := Executable()
 	if err != nil {
 		return nil, err
 	}
-	e, err := os.Open(epath)
+	return build(b)
+}
+
+// Binary is a kevi executable built for a platform
+type Binary struct {
+	Platform v1.Platform
+	Open     func() (io.ReadCloser, error)
+}
+
+// Executable returns the executed binary, built for the platform it's running on
+func Executable() (Binary, error) {
+	epath, err := os.Executable()
+	if err != nil {
+		return Binary{}, err
+	}
+	return Binary{
+		Platform: v1.Platform{OS: goruntime.GOOS, Architecture: goruntime.GOARCH},
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(epath)
+		},
+	}, nil
+}
+
+// BuildIndex builds an image for every binary, assembled into a multi-arch index so the controller runs on every
+// platform it was built for
+func BuildIndex(ctx context.Context, binaries []Binary) (v1.ImageIndex, error) {
+	idx := mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+	for _, b := range binaries {
+		img, err := build(b)
+		if err != nil {
+			return nil, err
+		}
+
+		platform := b.Platform
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				MediaType: types.OCIManifestSchema1,
+				Platform:  &platform,
+			},
+		})
+	}
+	return idx, nil
+}
+
+func build(b Binary) (v1.Image, error) {
+	e, err := b.Open()
 	if err != nil {
 		return nil, err
 	}
+	defer e.Close()
 
 	tmpdir, err := os.MkdirTemp("", "kevi")
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmpdir)
+	defer os.RemoveAll(tmpdir)
 
 	f, err := os.Create(filepath.Join(tmpdir, "kevi"))
 	if err != nil {
@@ -99,9 +209,6 @@ func Build(ctx context.Context) (v1.Image, error) {
 	if err := f.Close(); err != nil {
 		return nil, err
 	}
-	if err := e.Close(); err != nil {
-		return nil, err
-	}
 	if err := os.Chmod(f.Name(), os.ModePerm); err != nil {
 		return nil, err
 	}
@@ -113,8 +220,8 @@ func Build(ctx context.Context) (v1.Image, error) {
 
 	base := mutate.MediaType(empty.Image, ocispec.MediaTypeImageManifest)
 	base, err = mutate.ConfigFile(base, &v1.ConfigFile{
-		OS:           goruntime.GOOS,
-		Architecture: goruntime.GOARCH,
+		OS:           b.Platform.OS,
+		Architecture: b.Platform.Architecture,
 		Author:       "kevi",
 		Container:    "kevi-controller",
 		Config: v1.Config{
@@ -0,0 +1,233 @@
+package install
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"cattle.io/kevi/controllers"
+)
+
+func TestGenerate(t *testing.T) {
+	ha := MakeDefaultOptions()
+	ha.Namespace = "airgap"
+	ha.Replicas = 3
+	ha.NodeSelector = map[string]string{"node-role.kubernetes.io/control-plane": "true"}
+	ha.Tolerations = []corev1.Toleration{{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.TolerationOpExists}}
+	ha.PriorityClassName = "system-cluster-critical"
+	ha.PodDisruptionBudget = true
+
+	airgap := MakeDefaultOptions()
+	airgap.PullSecret = "registry-credentials"
+
+	tests := []struct {
+		name           string
+		opts           Options
+		wantReplicas   int32
+		wantLeader     bool
+		wantPDB        bool
+		wantScheduled  bool
+		wantPullSecret bool
+	}{
+		{
+			name:         "defaults",
+			opts:         MakeDefaultOptions(),
+			wantReplicas: 1,
+		},
+		{
+			name:          "highly available",
+			opts:          ha,
+			wantReplicas:  3,
+			wantLeader:    true,
+			wantPDB:       true,
+			wantScheduled: true,
+		},
+		{
+			name:           "pull secret",
+			opts:           airgap,
+			wantReplicas:   1,
+			wantPullSecret: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := Generate(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				deploy     appsv1.Deployment
+				pdb        bool
+				pullSecret bool
+			)
+			for _, obj := range objs {
+				if ns := obj.GetNamespace(); ns != "" && ns != tt.opts.Namespace {
+					t.Errorf("Generate() %s/%s namespace = %s, want %s", obj.GetKind(), obj.GetName(), ns, tt.opts.Namespace)
+				}
+				switch obj.GetKind() {
+				case "PodDisruptionBudget":
+					pdb = true
+				case "ClusterRole":
+					// only the pull secret's replicas need secrets to be created and deleted
+					pullSecret = pullSecret || obj.GetName() == "kevi-manager-pull-secret-role"
+				case "Deployment":
+					if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &deploy); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if *deploy.Spec.Replicas != tt.wantReplicas {
+				t.Errorf("Generate() replicas = %d, want %d", *deploy.Spec.Replicas, tt.wantReplicas)
+			}
+			if pdb != tt.wantPDB {
+				t.Errorf("Generate() pod disruption budget = %v, want %v", pdb, tt.wantPDB)
+			}
+			if pullSecret != tt.wantPullSecret {
+				t.Errorf("Generate() pull secret role = %v, want %v", pullSecret, tt.wantPullSecret)
+			}
+
+			pod := deploy.Spec.Template.Spec
+			args := map[string]bool{}
+			for _, a := range pod.Containers[0].Args {
+				args[a] = true
+			}
+			if args["--leader-elect"] != tt.wantLeader {
+				t.Errorf("Generate() leader election = %v, want %v", args["--leader-elect"], tt.wantLeader)
+			}
+			if !args["--namespace="+tt.opts.Namespace] {
+				t.Errorf("Generate() args = %v, want the manager's namespace", pod.Containers[0].Args)
+			}
+			if got := pod.Containers[0].Resources.Limits.Memory().String(); got != "256Mi" {
+				t.Errorf("Generate() memory limit = %s, want 256Mi", got)
+			}
+			if scheduled := len(pod.Tolerations) > 0 && len(pod.NodeSelector) > 0 && pod.PriorityClassName != ""; scheduled != tt.wantScheduled {
+				t.Errorf("Generate() scheduling = %+v, want it set %v", pod, tt.wantScheduled)
+			}
+		})
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	binary := func(os, arch string) Binary {
+		return Binary{
+			Platform: v1.Platform{OS: os, Architecture: arch},
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(os + "/" + arch)), nil
+			},
+		}
+	}
+
+	idx, err := BuildIndex(context.Background(), []Binary{binary("linux", "amd64"), binary("linux", "arm64")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Manifests) != 2 {
+		t.Fatalf("BuildIndex() manifests = %d, want 2", len(m.Manifests))
+	}
+
+	for _, desc := range m.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Architecture != desc.Platform.Architecture || cfg.OS != desc.Platform.OS {
+			t.Errorf("BuildIndex() image for %s/%s is %s/%s", desc.Platform.OS, desc.Platform.Architecture, cfg.OS, cfg.Architecture)
+		}
+	}
+}
+
+func TestUninstallObjects(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kevi-system", Labels: map[string]string{ControlPlaneLabel: "controller-manager"}}},
+	).Build()
+
+	tests := []struct {
+		name          string
+		namespace     string
+		wantNamespace bool
+	}{
+		{name: "created by kevi", namespace: "kevi-system", wantNamespace: true},
+		{name: "already deleted", namespace: "airgap", wantNamespace: true},
+		{name: "user's namespace", namespace: "apps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := UninstallObjects(context.Background(), c, tt.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kinds, names := map[string]bool{}, map[string]bool{}
+			for _, obj := range objs {
+				kinds[obj.GetKind()] = true
+				names[obj.GetName()] = true
+				if obj.GetKind() == "Namespace" && obj.GetName() != tt.namespace {
+					t.Errorf("UninstallObjects() namespace = %s, want %s", obj.GetName(), tt.namespace)
+				}
+			}
+			if kinds["Namespace"] != tt.wantNamespace {
+				t.Errorf("UninstallObjects() includes the namespace = %v, want %v", kinds["Namespace"], tt.wantNamespace)
+			}
+			for _, kind := range []string{"CustomResourceDefinition", "ClusterRoleBinding", "Deployment", "PodDisruptionBudget", "MutatingWebhookConfiguration"} {
+				if !kinds[kind] {
+					t.Errorf("UninstallObjects() has no %s", kind)
+				}
+			}
+			if !names["kevi-manager-pull-secret-role"] {
+				t.Errorf("UninstallObjects() has no pull secret role")
+			}
+		})
+	}
+}
+
+func TestPullSecretReplicas(t *testing.T) {
+	secret := func(namespace string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "airgap", Labels: labels}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		secret("kevi-system", nil),
+		secret("apps", map[string]string{controllers.PullSecretReplicaLabel: "true"}),
+		secret("jobs", map[string]string{controllers.PullSecretReplicaLabel: "true"}),
+		secret("mine", map[string]string{"app": "mine"}),
+	).Build()
+
+	objs, err := PullSecretReplicas(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, obj := range objs {
+		if obj.GetKind() != "Secret" {
+			t.Errorf("PullSecretReplicas() kind = %s, want Secret", obj.GetKind())
+		}
+		got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "apps/airgap,jobs/airgap" {
+		t.Errorf("PullSecretReplicas() = %v, want the replicas in apps and jobs", got)
+	}
+}
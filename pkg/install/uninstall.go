@@ -0,0 +1,73 @@
+package install
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"cattle.io/kevi/controllers"
+)
+
+// UninstallObjects returns every object an install into namespace may have created, whatever options it was
+// installed with, for deleting kevi. The namespace itself is only included if kevi created it.
+func UninstallObjects(ctx context.Context, c client.Reader, namespace string) ([]*unstructured.Unstructured, error) {
+	opts := MakeDefaultOptions()
+	opts.Namespace = namespace
+	opts.PodDisruptionBudget = true
+	opts.RequireServiceAccount = false
+	// a placeholder pull secret includes the role its replicas are written with
+	opts.PullSecret = "pull-secret"
+
+	objs, err := Generate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return WithoutForeignNamespace(ctx, c, namespace, objs)
+}
+
+// WithoutForeignNamespace removes the Namespace from objs when namespace already exists but wasn't created by kevi,
+// which labels the namespaces it creates with ControlPlaneLabel, so kevi never claims or deletes a user's namespace
+func WithoutForeignNamespace(ctx context.Context, c client.Reader, namespace string, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	var ns corev1.Namespace
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, &ns); apierrors.IsNotFound(err) {
+		return objs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if ns.Labels[ControlPlaneLabel] == "controller-manager" {
+		return objs, nil
+	}
+
+	var kept []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == "Namespace" && obj.GetName() == namespace {
+			continue
+		}
+		kept = append(kept, obj)
+	}
+	return kept, nil
+}
+
+// PullSecretReplicas returns the copies of the registry's pull secret the manager replicated into the namespaces of
+// relocated pods. They aren't part of the install, so they're deleted separately once the manager can no longer
+// replicate them again.
+func PullSecretReplicas(ctx context.Context, c client.Reader) ([]*unstructured.Unstructured, error) {
+	var list corev1.SecretList
+	if err := c.List(ctx, &list, client.HasLabels{controllers.PullSecretReplicaLabel}); err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, secret := range list.Items {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		obj.SetNamespace(secret.Namespace)
+		obj.SetName(secret.Name)
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
@@ -0,0 +1,119 @@
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Masterminds/semver/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NameLabel and VersionLabel identify an installed manager and the version of kevi it runs
+	NameLabel    = "app.kubernetes.io/name"
+	VersionLabel = "app.kubernetes.io/version"
+
+	// OptionsAnnotation records the hash of the options a manager was installed with
+	OptionsAnnotation = "kevi.cattle.io/install-options"
+
+	// ControlPlaneLabel marks every object kevi installs, including those of installs that predate NameLabel
+	ControlPlaneLabel = "control-plane"
+
+	// UnknownVersion is the version of installs that predate VersionLabel
+	UnknownVersion = "unknown"
+)
+
+// Action is what installing kevi does to an existing installation
+type Action string
+
+const (
+	ActionInstall   Action = "install"
+	ActionUnchanged Action = "unchanged"
+	ActionUpgrade   Action = "upgrade"
+	ActionDowngrade Action = "downgrade"
+)
+
+// Installation is an installed manager
+type Installation struct {
+	Version     string
+	OptionsHash string
+}
+
+// Hash returns a hash of the options, excluding the image which is rebuilt by every install
+func (o Options) Hash() (string, error) {
+	o.Image = ""
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])[:16], nil
+}
+
+// Detect returns the manager installed in namespace, or nil if kevi isn't installed there. Managers installed before
+// their version was recorded are detected by their ControlPlaneLabel, with UnknownVersion.
+func Detect(ctx context.Context, c client.Reader, namespace string) (*Installation, error) {
+	for _, labels := range []client.MatchingLabels{
+		{NameLabel: "kevi"},
+		{ControlPlaneLabel: "controller-manager"},
+	} {
+		var deploys appsv1.DeploymentList
+		if err := c.List(ctx, &deploys, client.InNamespace(namespace), labels); err != nil {
+			return nil, err
+		}
+		if len(deploys.Items) == 0 {
+			continue
+		}
+
+		d := deploys.Items[0]
+		v, ok := d.Labels[VersionLabel]
+		if !ok {
+			v = UnknownVersion
+		}
+		return &Installation{
+			Version:     v,
+			OptionsHash: d.Annotations[OptionsAnnotation],
+		}, nil
+	}
+	return nil, nil
+}
+
+// Plan returns what installing opts does to an installation. Versions that aren't semantic versions, such as
+// development builds, can only be compared for equality, so a different one is always an upgrade.
+func Plan(installed *Installation, opts Options) (Action, error) {
+	if installed == nil {
+		return ActionInstall, nil
+	}
+
+	hash, err := opts.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	if installed.Version == opts.Version {
+		if installed.OptionsHash == hash {
+			return ActionUnchanged, nil
+		}
+		return ActionUpgrade, nil
+	}
+
+	from, err := semver.NewVersion(installed.Version)
+	if err != nil {
+		return ActionUpgrade, nil
+	}
+	to, err := semver.NewVersion(opts.Version)
+	if err != nil {
+		return ActionUpgrade, nil
+	}
+
+	switch {
+	case to.LessThan(from):
+		return ActionDowngrade, nil
+	case to.Equal(from) && installed.OptionsHash == hash:
+		return ActionUnchanged, nil
+	}
+	return ActionUpgrade, nil
+}
@@ -0,0 +1,87 @@
+package install
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPlan(t *testing.T) {
+	opts := MakeDefaultOptions()
+	opts.Version = "v0.2.0"
+	hash, err := opts.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		installed *Installation
+		want      Action
+	}{
+		{name: "fresh install", want: ActionInstall},
+		{name: "same version and options", installed: &Installation{Version: "v0.2.0", OptionsHash: hash}, want: ActionUnchanged},
+		{name: "same version with other options", installed: &Installation{Version: "v0.2.0", OptionsHash: "other"}, want: ActionUpgrade},
+		{name: "newer version", installed: &Installation{Version: "v0.1.3", OptionsHash: hash}, want: ActionUpgrade},
+		{name: "older version", installed: &Installation{Version: "v0.10.0", OptionsHash: hash}, want: ActionDowngrade},
+		{name: "development build", installed: &Installation{Version: "devel", OptionsHash: hash}, want: ActionUpgrade},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Plan(tt.installed, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Plan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:        "kevi-controller-manager",
+			Namespace:   "kevi-system",
+			Labels:      map[string]string{NameLabel: "kevi", VersionLabel: "v0.1.0"},
+			Annotations: map[string]string{OptionsAnnotation: "abc"},
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      "kevi-controller-manager",
+			Namespace: "legacy",
+			Labels:    map[string]string{ControlPlaneLabel: "controller-manager"},
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "apps"}},
+	).Build()
+
+	got, err := Detect(ctx, c, "kevi-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Version != "v0.1.0" || got.OptionsHash != "abc" {
+		t.Errorf("Detect() = %+v, want v0.1.0 with its options", got)
+	}
+
+	got, err = Detect(ctx, c, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Version != UnknownVersion {
+		t.Errorf("Detect() = %+v, want an install of an unknown version", got)
+	}
+
+	got, err = Detect(ctx, c, "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("Detect() = %+v, want no installation", got)
+	}
+}
@@ -0,0 +1,214 @@
+package mirrors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/yaml"
+
+	"cattle.io/kevi/pkg/pack"
+)
+
+const (
+	// dockerHub is the name containerd and k3s configure mirrors of docker hub under
+	dockerHub = "docker.io"
+
+	// dockerHubServer is the endpoint containerd pulls from docker hub when no mirror responds
+	dockerHubServer = "https://registry-1.docker.io"
+)
+
+// Options configure how nodes pull the images of source registries from the airgap registry
+type Options struct {
+	// Registry is the airgap registry images were relocated to
+	Registry string
+
+	// Strategy is how images were relocated, which decides the path a source registry is mirrored at
+	Strategy pack.RelocationStrategy
+
+	Username string
+	Password string
+
+	// PlainHTTP mirrors to the registry over http instead of https
+	PlainHTTP bool
+
+	// Insecure skips verifying the registry's certificate
+	Insecure bool
+
+	// CAFile, CertFile and KeyFile are paths on the nodes of the registry's CA and client certificate
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// Sources returns the distinct source registries of images, skipping images already in the airgap registry
+func Sources(images []string, registry string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, image := range images {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return nil, err
+		}
+		if source := ref.Context().RegistryStr(); source != registry {
+			seen[source] = true
+		}
+	}
+
+	var sources []string
+	for s := range seen {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+type hostsFile struct {
+	Server string                `toml:"server"`
+	Host   map[string]hostConfig `toml:"host"`
+}
+
+type hostConfig struct {
+	Capabilities []string            `toml:"capabilities"`
+	OverridePath bool                `toml:"override_path,omitempty"`
+	SkipVerify   bool                `toml:"skip_verify,omitempty"`
+	CA           string              `toml:"ca,omitempty"`
+	Client       [][]string          `toml:"client,omitempty"`
+	Header       map[string][]string `toml:"header,omitempty"`
+}
+
+// HostsTOML returns the containerd hosts.toml mirroring a source registry to the airgap registry
+func HostsTOML(source string, opts Options) ([]byte, error) {
+	server := "https://" + source
+	if source == name.DefaultRegistry {
+		server = dockerHubServer
+	}
+
+	host := hostConfig{
+		Capabilities: []string{"pull", "resolve"},
+		SkipVerify:   opts.Insecure,
+		CA:           opts.CAFile,
+	}
+	endpoint := opts.endpoint()
+	// containerd only adds /v2 to the endpoint's path when it isn't overridden
+	if prefix := opts.Strategy.Prefix(source); prefix != "" {
+		endpoint += "/v2/" + prefix
+		host.OverridePath = true
+	}
+	if opts.CertFile != "" {
+		host.Client = [][]string{{opts.CertFile, opts.KeyFile}}
+	}
+	if opts.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + opts.Password))
+		host.Header = map[string][]string{"authorization": {"Basic " + auth}}
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(hostsFile{
+		Server: server,
+		Host:   map[string]hostConfig{endpoint: host},
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type registriesFile struct {
+	Mirrors map[string]mirror         `json:"mirrors"`
+	Configs map[string]registryConfig `json:"configs,omitempty"`
+}
+
+type mirror struct {
+	Endpoint []string          `json:"endpoint"`
+	Rewrite  map[string]string `json:"rewrite,omitempty"`
+}
+
+type registryConfig struct {
+	Auth *registryAuth `json:"auth,omitempty"`
+	TLS  *registryTLS  `json:"tls,omitempty"`
+}
+
+type registryAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type registryTLS struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// RegistriesYAML returns the k3s and RKE2 registries.yaml mirroring every source registry to the airgap registry
+func RegistriesYAML(sources []string, opts Options) ([]byte, error) {
+	f := registriesFile{Mirrors: make(map[string]mirror)}
+	for _, source := range sources {
+		m := mirror{Endpoint: []string{opts.endpoint()}}
+		if prefix := opts.Strategy.Prefix(source); prefix != "" {
+			m.Rewrite = map[string]string{"^(.*)$": prefix + "/$1"}
+		}
+		f.Mirrors[configName(source)] = m
+	}
+
+	var c registryConfig
+	if opts.Username != "" {
+		c.Auth = &registryAuth{Username: opts.Username, Password: opts.Password}
+	}
+	if opts.Insecure || opts.CAFile != "" || opts.CertFile != "" {
+		c.TLS = &registryTLS{
+			CAFile:             opts.CAFile,
+			CertFile:           opts.CertFile,
+			KeyFile:            opts.KeyFile,
+			InsecureSkipVerify: opts.Insecure,
+		}
+	}
+	if c.Auth != nil || c.TLS != nil {
+		f.Configs = map[string]registryConfig{opts.Registry: c}
+	}
+
+	return yaml.Marshal(f)
+}
+
+// Write writes the hosts.toml of every source registry to dir/certs.d/<source>/hosts.toml, and the registries.yaml
+// of them all to dir/registries.yaml
+func Write(dir string, sources []string, opts Options) error {
+	for _, source := range sources {
+		data, err := HostsTOML(source, opts)
+		if err != nil {
+			return err
+		}
+
+		hostDir := filepath.Join(dir, "certs.d", configName(source))
+		if err := os.MkdirAll(hostDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(hostDir, "hosts.toml"), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	data, err := RegistriesYAML(sources, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "registries.yaml"), data, 0600)
+}
+
+func (o Options) endpoint() string {
+	if o.PlainHTTP {
+		return "http://" + o.Registry
+	}
+	return "https://" + o.Registry
+}
+
+// configName is the name containerd and k3s configure a source registry's mirror under
+func configName(source string) string {
+	if source == name.DefaultRegistry {
+		return dockerHub
+	}
+	return source
+}
@@ -0,0 +1,117 @@
+package mirrors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cattle.io/kevi/pkg/pack"
+)
+
+func TestSources(t *testing.T) {
+	got, err := Sources([]string{
+		"busybox",
+		"ghcr.io/stefanprodan/podinfo:6.0.3",
+		"ghcr.io/fluxcd/flux-cli:v0.24.0",
+		"registry.local:5000/kevi/kevi-podinfo:latest",
+	}, "registry.local:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"ghcr.io", "index.docker.io"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sources() = %v, want %v", got, want)
+	}
+}
+
+func TestHostsTOML(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   Options
+		want   []string
+	}{
+		{
+			name:   "repository strategy",
+			source: "index.docker.io",
+			opts:   Options{Registry: "registry.local:5000", Strategy: pack.RelocateRepository},
+			want: []string{
+				`server = "https://registry-1.docker.io"`,
+				`[host."https://registry.local:5000"]`,
+			},
+		},
+		{
+			name:   "host strategy overrides the path",
+			source: "ghcr.io",
+			opts:   Options{Registry: "registry.local:5000", Strategy: pack.RelocateHost, PlainHTTP: true},
+			want: []string{
+				`server = "https://ghcr.io"`,
+				`[host."http://registry.local:5000/v2/ghcr.io"]`,
+				`override_path = true`,
+			},
+		},
+		{
+			name:   "auth and tls",
+			source: "ghcr.io",
+			opts: Options{
+				Registry: "registry.local", Strategy: pack.RelocateRepository,
+				Username: "kevi", Password: "secret", Insecure: true,
+				CAFile: "/etc/ca.crt", CertFile: "/etc/client.crt", KeyFile: "/etc/client.key",
+			},
+			want: []string{
+				`skip_verify = true`,
+				`ca = "/etc/ca.crt"`,
+				`client = [["/etc/client.crt", "/etc/client.key"]]`,
+				`authorization = ["Basic a2V2aTpzZWNyZXQ="]`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HostsTOML(tt.source, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(got), w) {
+					t.Errorf("HostsTOML() = %s, want it to contain %s", got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistriesYAML(t *testing.T) {
+	got, err := RegistriesYAML([]string{"ghcr.io", "index.docker.io"}, Options{
+		Registry: "registry.local:5000",
+		Strategy: pack.RelocateHost,
+		Username: "kevi",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `configs:
+  registry.local:5000:
+    auth:
+      password: secret
+      username: kevi
+mirrors:
+  docker.io:
+    endpoint:
+    - https://registry.local:5000
+    rewrite:
+      ^(.*)$: index.docker.io/$1
+  ghcr.io:
+    endpoint:
+    - https://registry.local:5000
+    rewrite:
+      ^(.*)$: ghcr.io/$1
+`
+	if string(got) != want {
+		t.Errorf("RegistriesYAML() = %s, want %s", got, want)
+	}
+}
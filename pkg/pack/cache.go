@@ -0,0 +1,169 @@
+package pack
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	"cattle.io/kevi/api/v1alpha1"
+)
+
+const (
+	// DefaultCacheSize is the default size in bytes of a Cache's content
+	DefaultCacheSize = 128 << 20
+)
+
+// Cache is a content addressed cache of loaded packages and their rendered manifests, bounded by the total size of
+// their content. Loaded packages are keyed by their digest, and rendered manifests are keyed by the digest plus the
+// inputs used to render them, so an unchanged package never needs to be fetched or rendered twice. Packages are closed
+// when they're evicted.
+type Cache struct {
+	lru *lru
+}
+
+// NewCache returns a cache holding up to size bytes of content, size <= 0 uses DefaultCacheSize
+func NewCache(size int64) *Cache {
+	return &Cache{
+		lru: newLRU(size),
+	}
+}
+
+func (c *Cache) GetPackage(desc ocispec.Descriptor) (Package, bool) {
+	v, ok := c.lru.get("package/" + desc.Digest.String())
+	if !ok {
+		return nil, false
+	}
+	return v.(Package), true
+}
+
+// AddPackage caches a loaded package, which the cache then owns and closes when it's evicted. A package larger than
+// the cache is closed immediately.
+func (c *Cache) AddPackage(desc ocispec.Descriptor, p Package) {
+	var size int64
+	if s, ok := p.(sized); ok {
+		size = s.contentSize()
+	}
+	c.lru.add("package/"+desc.Digest.String(), p, size)
+}
+
+func (c *Cache) GetRendered(key string) ([]byte, bool) {
+	v, ok := c.lru.get("render/" + key)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (c *Cache) AddRendered(key string, data []byte) {
+	c.lru.add("render/"+key, data, int64(len(data)))
+}
+
+// sized is implemented by packages that know the size of their content
+type sized interface {
+	contentSize() int64
+}
+
+// renderInputs are the fields of a package that influence what it renders to, fields that only change how it's synced,
+// such as dependsOn or syncOptions, are left out so changing them doesn't invalidate rendered manifests
+type renderInputs struct {
+	Manifest v1alpha1.KeviSpecPackageManifest `json:"manifest"`
+	Chart    v1alpha1.KeviSpecPackageChart    `json:"chart"`
+	Images   []string                         `json:"images"`
+}
+
+// RenderKey identifies a rendered package by its content digest and every input that could influence rendering
+func RenderKey(desc ocispec.Descriptor, pkg v1alpha1.KeviSpecPackage) (string, error) {
+	inputs, err := json.Marshal(renderInputs{
+		Manifest: pkg.Manifest,
+		Chart:    pkg.Chart,
+		Images:   pkg.Images,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(desc.Digest.String()))
+	h.Write(inputs)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lru is a minimal least recently used cache bounded by the total size of its values, safe for concurrent use.
+// Evicted values that are io.Closers are closed.
+type lru struct {
+	mu    sync.Mutex
+	size  int64
+	used  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+func newLRU(size int64) *lru {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &lru{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (l *lru) add(key string, value interface{}, size int64) {
+	var evicted []interface{}
+
+	l.mu.Lock()
+	if e, ok := l.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		// a replaced package is closed, rendered manifests aren't comparable and need no closing
+		if c, ok := entry.value.(io.Closer); ok && c != value {
+			evicted = append(evicted, c)
+		}
+		l.used += size - entry.size
+		entry.value, entry.size = value, size
+		l.ll.MoveToFront(e)
+	} else {
+		l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, size: size})
+		l.used += size
+	}
+
+	for l.used > l.size && l.ll.Len() > 0 {
+		oldest := l.ll.Back()
+		entry := oldest.Value.(*lruEntry)
+		l.ll.Remove(oldest)
+		delete(l.items, entry.key)
+		l.used -= entry.size
+		evicted = append(evicted, entry.value)
+	}
+	l.mu.Unlock()
+
+	// closing waits on any generate still using a package, so it's done outside the lock
+	for _, v := range evicted {
+		if c, ok := v.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
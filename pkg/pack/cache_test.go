@@ -0,0 +1,99 @@
+package pack_test
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/pkg/pack"
+)
+
+func TestCache_Rendered(t *testing.T) {
+	c := pack.NewCache(2)
+
+	for _, k := range []string{"a", "b", "c"} {
+		c.AddRendered(k, []byte(k))
+	}
+
+	if _, ok := c.GetRendered("a"); ok {
+		t.Errorf("expected oldest entry to be evicted")
+	}
+	if data, ok := c.GetRendered("c"); !ok || string(data) != "c" {
+		t.Errorf("GetRendered() got = %s, %v, want c, true", data, ok)
+	}
+}
+
+func TestRenderKey(t *testing.T) {
+	desc := ocispec.Descriptor{Digest: digest.FromString("podinfo")}
+	pkg := v1alpha1.KeviSpecPackage{
+		Name:  "podinfo",
+		Chart: v1alpha1.KeviSpecPackageChart{Path: "testdata/podinfo-6.0.3.tgz"},
+	}
+
+	k1, err := pack.RenderKey(desc, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := pack.RenderKey(desc, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 != k2 {
+		t.Errorf("RenderKey() is not stable, got %s and %s", k1, k2)
+	}
+
+	pkg.Images = []string{"alpine:latest"}
+	k3, err := pack.RenderKey(desc, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 == k3 {
+		t.Errorf("RenderKey() should change when render inputs change")
+	}
+
+	k4, err := pack.RenderKey(ocispec.Descriptor{Digest: digest.FromString("other")}, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k3 == k4 {
+		t.Errorf("RenderKey() should change when the package digest changes")
+	}
+
+	pkg.DependsOn = []string{"crds"}
+	pkg.SyncOptions.ServerSideApply = true
+	pkg.IgnoreDifferences = []v1alpha1.KeviResourceIgnoreDifferences{{JSONPointers: []string{"/spec/replicas"}}}
+	k5, err := pack.RenderKey(desc, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k3 != k5 {
+		t.Errorf("RenderKey() shouldn't change when only sync settings change")
+	}
+}
+
+type closingPackage struct {
+	pack.Package
+	closed bool
+}
+
+func (p *closingPackage) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestCache_ClosesEvictedPackages(t *testing.T) {
+	c := pack.NewCache(4)
+
+	p := &closingPackage{}
+	c.AddPackage(ocispec.Descriptor{Digest: digest.FromString("a")}, p)
+	c.AddRendered("big", []byte("12345"))
+
+	if _, ok := c.GetPackage(ocispec.Descriptor{Digest: digest.FromString("a")}); ok {
+		t.Errorf("expected package to be evicted")
+	}
+	if !p.closed {
+		t.Errorf("expected evicted package to be closed")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/rancherfederal/ocil/pkg/artifacts"
@@ -22,6 +23,7 @@ import (
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 
@@ -46,6 +48,13 @@ type Chart struct {
 
 	chart *chart.Chart
 	path  string
+
+	// mu guards closed. Charts loaded to disk are only held as their archive, and loaded when they're generated.
+	mu      sync.RWMutex
+	archive string
+	dir     string
+	size    int64
+	closed  bool
 }
 
 func NewChart(name string, cpkg v1alpha1.KeviSpecPackageChart) (*Chart, error) {
@@ -88,6 +97,7 @@ func NewChart(name string, cpkg v1alpha1.KeviSpecPackageChart) (*Chart, error) {
 		Name:  name,
 		chart: ch,
 		path:  abs,
+		size:  chartSize(ch),
 	}, nil
 }
 
@@ -132,6 +142,26 @@ func (c *Chart) Reference() string {
 }
 
 func (c *Chart) Generate() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, ErrPackageClosed
+	}
+
+	ch := c.chart
+	if ch == nil {
+		f, err := os.Open(c.archive)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if ch, err = loader.LoadArchive(f); err != nil {
+			return nil, err
+		}
+	}
+
 	s := storage.Init(driver.NewMemory())
 	cfg := &action.Configuration{
 		Releases:     s,
@@ -147,12 +177,58 @@ func (c *Chart) Generate() ([]byte, error) {
 	client.IncludeCRDs = true
 
 	vals := make(map[string]interface{})
-	release, err := client.Run(c.chart, vals)
+	rel, err := client.Run(ch, vals)
 	if err != nil {
 		return nil, err
 	}
 
-	return []byte(release.Manifest), nil
+	// hooks are kept with their helm.sh/hook annotations, which gitops-engine runs as PreSync and PostSync hooks
+	var b bytes.Buffer
+	b.WriteString(rel.Manifest)
+	for _, h := range rel.Hooks {
+		if !syncedHook(h) {
+			continue
+		}
+		fmt.Fprintf(&b, "\n---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
+	return b.Bytes(), nil
+}
+
+// Close removes the chart's archive from disk, after which it can't be generated
+func (c *Chart) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(c.dir)
+}
+
+func (c *Chart) contentSize() int64 {
+	return c.size
+}
+
+// chartSize is the size of every file of a chart
+func chartSize(ch *chart.Chart) int64 {
+	var size int64
+	for _, f := range ch.Raw {
+		size += int64(len(f.Data))
+	}
+	return size
+}
+
+// syncedHook returns true for hooks run on install or upgrade, other hooks (tests, deletes, rollbacks) have no
+// equivalent when syncing
+func syncedHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		switch e {
+		case release.HookPreInstall, release.HookPostInstall, release.HookPreUpgrade, release.HookPostUpgrade:
+			return true
+		}
+	}
+	return false
 }
 
 // tgz returns the data of a gzip compressed archive of the chart
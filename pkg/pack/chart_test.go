@@ -1,6 +1,9 @@
 package pack_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"cattle.io/kevi/api/v1alpha1"
@@ -66,3 +69,69 @@ func TestChart_Generate(t *testing.T) {
 		})
 	}
 }
+
+func TestChart_GenerateHooks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks")
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: hooks\nversion: 0.1.0\n",
+		"templates/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+`,
+		"templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+    helm.sh/hook-weight: "-1"
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: migrate:latest
+`,
+		"templates/test.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: test
+  annotations:
+    helm.sh/hook: test
+spec:
+  containers:
+  - name: test
+    image: test:latest
+`,
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := pack.NewChart("hooks", v1alpha1.KeviSpecPackageChart{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"name: app", "name: migrate", "helm.sh/hook: pre-install,pre-upgrade"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("Generate() missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(string(got), "name: test") {
+		t.Errorf("Generate() included a test hook:\n%s", got)
+	}
+}
@@ -27,18 +27,30 @@ import (
 )
 
 var (
-	_           Package = &Manifest{}
+	_ Package = &Manifest{}
+
+	// krusty resets kyaml's global OpenAPI schema version on every build, and the target it builds with is internal to
+	// kustomize so it can't be avoided, so builds run exclusively. Fetching and extracting packages, rendering charts and
+	// syncing still run concurrently.
 	kbuildMutex sync.Mutex
 )
 
 type Manifest struct {
 	Name string
 
+	// mu guards fs, which is mutated when generating a root kustomization, and closed
+	mu sync.Mutex
 	fs filesys.FileSystem
+
+	// root is the directory of fs the manifests are in, and dir the directory they were extracted to on disk
+	root   string
+	dir    string
+	size   int64
+	closed bool
 }
 
 func NewManifest(name string, mpkg v1alpha1.KeviSpecPackageManifest) (*Manifest, error) {
-	fsys, err := generateFS(mpkg.Path)
+	fsys, size, err := generateFS(mpkg.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +58,9 @@ func NewManifest(name string, mpkg v1alpha1.KeviSpecPackageManifest) (*Manifest,
 	return &Manifest{
 		Name: name,
 
-		fs: fsys,
+		fs:   fsys,
+		root: "/",
+		size: size,
 	}, nil
 }
 
@@ -88,14 +102,21 @@ func (m *Manifest) Contents() (map[string]artifacts.OCI, error) {
 }
 
 func (m *Manifest) Generate() ([]byte, error) {
-	if err := generateRootKustomizationIfDNE(m.fs); err != nil {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrPackageClosed
+	}
+
+	if err := generateRootKustomizationIfDNE(m.fs, m.root); err != nil {
 		return nil, err
 	}
 
 	kbuildMutex.Lock()
 	defer kbuildMutex.Unlock()
 
-	kz, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(m.fs, ".")
+	kz, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(m.fs, m.root)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +124,22 @@ func (m *Manifest) Generate() ([]byte, error) {
 	return kz.AsYaml()
 }
 
+// Close removes the manifests extracted to disk, after which they can't be generated
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	if m.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(m.dir)
+}
+
+func (m *Manifest) contentSize() int64 {
+	return m.size
+}
+
 func (m *Manifest) tgz() ([]byte, error) {
 	var b bytes.Buffer
 	gw := gzip.NewWriter(&b)
@@ -154,9 +191,10 @@ func (m *Manifest) tgz() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// generateFS will generate an in memory FS given a path of manifests
-func generateFS(root string) (filesys.FileSystem, error) {
+// generateFS will generate an in memory FS given a path of manifests, along with the size of its files
+func generateFS(root string) (filesys.FileSystem, int64, error) {
 	fsys := filesys.MakeFsInMemory()
+	var size int64
 	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -190,25 +228,26 @@ func generateFS(root string) (filesys.FileSystem, error) {
 		if err := fsys.WriteFile(p, data); err != nil {
 			return err
 		}
+		size += int64(len(data))
 
 		return nil
 	}); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return fsys, nil
+	return fsys, size, nil
 }
 
-func generateRootKustomizationIfDNE(fsys filesys.FileSystem) error {
+func generateRootKustomizationIfDNE(fsys filesys.FileSystem, root string) error {
 	for _, f := range konfig.RecognizedKustomizationFileNames() {
-		if _, err := fsys.ReadFile(f); err == nil {
+		if _, err := fsys.ReadFile(filepath.Join(root, f)); err == nil {
 			return nil
 		}
 	}
 
 	rf := provider.NewDefaultDepProvider().GetResourceFactory()
 	var resources []string
-	if err := fsys.Walk(".", func(path string, info fs.FileInfo, err error) error {
+	if err := fsys.Walk(root, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -230,7 +269,11 @@ func generateRootKustomizationIfDNE(fsys filesys.FileSystem) error {
 			return err
 		}
 
-		resources = append(resources, path)
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, rel)
 		return nil
 
 	}); err != nil {
@@ -250,7 +293,7 @@ func generateRootKustomizationIfDNE(fsys filesys.FileSystem) error {
 		return err
 	}
 
-	if err := fsys.WriteFile("kustomization.yaml", data); err != nil {
+	if err := fsys.WriteFile(filepath.Join(root, "kustomization.yaml"), data); err != nil {
 		return err
 	}
 
@@ -0,0 +1,81 @@
+package pack_test
+
+import (
+	"fmt"
+	"testing"
+
+	"cattle.io/kevi/api/v1alpha1"
+	"cattle.io/kevi/pkg/pack"
+)
+
+var benchmarkManifests = []v1alpha1.KeviSpecPackageManifest{
+	{Path: "../../testdata/kustomize"},
+	{Path: "../../testdata/raw-manifests"},
+}
+
+// BenchmarkManifest_Generate compares rendering manifests one at a time against rendering them concurrently. Kustomize
+// builds still run exclusively, see kbuildMutex, so the parallel variant doesn't scale with GOMAXPROCS.
+func BenchmarkManifest_Generate(b *testing.B) {
+	b.Run("serial", func(b *testing.B) {
+		ms := newBenchmarkManifests(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := ms[i%len(ms)].Generate(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			ms := newBenchmarkManifests(b)
+			i := 0
+			for pb.Next() {
+				if _, err := ms[i%len(ms)].Generate(); err != nil {
+					b.Error(err)
+					return
+				}
+				i++
+			}
+		})
+	})
+}
+
+func newBenchmarkManifests(b *testing.B) []*pack.Manifest {
+	var ms []*pack.Manifest
+	for _, mpkg := range benchmarkManifests {
+		m, err := pack.NewManifest("bench", mpkg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// TestManifest_GenerateConcurrent renders several manifests at once, and is meant to be run with -race
+func TestManifest_GenerateConcurrent(t *testing.T) {
+	var ms []*pack.Manifest
+	for i := 0; i < 4; i++ {
+		for _, mpkg := range benchmarkManifests {
+			m, err := pack.NewManifest(fmt.Sprintf("manifest-%d", i), mpkg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms = append(ms, m)
+		}
+	}
+
+	errs := make(chan error, len(ms))
+	for _, m := range ms {
+		go func(m *pack.Manifest) {
+			_, err := m.Generate()
+			errs <- err
+		}(m)
+	}
+	for range ms {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
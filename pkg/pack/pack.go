@@ -2,12 +2,18 @@ package pack
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"path"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
 	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
 	"github.com/rancherfederal/ocil/pkg/consts"
 	"github.com/rancherfederal/ocil/pkg/store"
@@ -31,7 +37,9 @@ type Oci struct {
 	*store.OCI
 }
 
-func (o *Oci) CopyAll(ctx context.Context, registry string, opts content.RegistryOptions) ([]ocispec.Descriptor, error) {
+// CopyAll copies every reference in the store to registry, relocating images with strategy. Kevi's own packages are
+// always relocated by repository, where the controller fetches them from.
+func (o *Oci) CopyAll(ctx context.Context, registry string, opts content.RegistryOptions, strategy RelocationStrategy) ([]ocispec.Descriptor, error) {
 	r, err := content.NewRegistry(opts)
 	if err != nil {
 		return nil, err
@@ -39,7 +47,17 @@ func (o *Oci) CopyAll(ctx context.Context, registry string, opts content.Registr
 
 	var descs []ocispec.Descriptor
 	if walkErr := o.Walk(func(reference string, desc ocispec.Descriptor) error {
-		toRef, err := Relocate(reference, registry)
+		// controller binaries are assembled into the controller's image when it's installed, not pulled themselves
+		if strings.HasPrefix(reference, ControllerBinaryRepository+":") {
+			return nil
+		}
+
+		s := strategy
+		if strings.HasPrefix(reference, fetcher.DefaultRepositoryNamespace+"/") {
+			s = RelocateRepository
+		}
+
+		toRef, err := s.Relocate(reference, registry)
 		if err != nil {
 			return err
 		}
@@ -70,7 +88,7 @@ func (o *Oci) Pack(ctx context.Context, k v1alpha1.Kevi) ([]ocispec.Descriptor,
 	}
 	pm := memory.NewMemory(pkgData, v1alpha1.KeviPackageLayerMediaType)
 
-	pkgref := path.Join(fetcher.DefaultRepositoryNamespace, "kevi-"+k.Name)
+	pkgref := keviReferencePrefix + k.Name
 	pkgDesc, err := o.AddOCI(ctx, pm, pkgref)
 	if err != nil {
 		return nil, err
@@ -105,6 +123,111 @@ func (o *Oci) pack(ctx context.Context, pkg v1alpha1.KeviSpecPackage) ([]ocispec
 	return o.AddOCICollection(ctx, coll)
 }
 
+// keviReferencePrefix prefixes the reference of every packed kevi, nothing else packed may share it
+var keviReferencePrefix = path.Join(fetcher.DefaultRepositoryNamespace, "kevi-")
+
+// WalkKevis calls fn with every kevi packed in the store
+func (o *Oci) WalkKevis(ctx context.Context, fn func(reference string, k *v1alpha1.Kevi) error) error {
+	return o.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if !strings.HasPrefix(reference, keviReferencePrefix) {
+			return nil
+		}
+
+		k, err := o.fetchKevi(ctx, reference, desc)
+		if err != nil {
+			return err
+		}
+		return fn(reference, k)
+	})
+}
+
+func (o *Oci) fetchKevi(ctx context.Context, reference string, desc ocispec.Descriptor) (*v1alpha1.Kevi, error) {
+	var m ocispec.Manifest
+	if err := o.fetchJSON(ctx, desc, &m); err != nil {
+		return nil, err
+	}
+
+	for _, l := range m.Layers {
+		if l.MediaType != v1alpha1.KeviPackageLayerMediaType {
+			continue
+		}
+
+		var k v1alpha1.Kevi
+		if err := o.fetchJSON(ctx, l, &k); err != nil {
+			return nil, err
+		}
+		return &k, nil
+	}
+	return nil, fmt.Errorf("unable to parse kevi object from %s", reference)
+}
+
+func (o *Oci) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	rc, err := o.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ControllerBinaryRepository is where controller binaries for other platforms are packed, tagged by platform. It's
+// outside keviReferencePrefix so binaries are never mistaken for kevis.
+var ControllerBinaryRepository = path.Join(fetcher.DefaultRepositoryNamespace, "controller-binary")
+
+// AddControllerBinary packs the controller binary at path, built for a platform such as linux/arm64
+func (o *Oci) AddControllerBinary(ctx context.Context, platform string, path string) (ocispec.Descriptor, error) {
+	if _, err := ParsePlatform(platform); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	tag := strings.ReplaceAll(platform, "/", "-")
+	return o.AddOCI(ctx, file.NewFile(path), ControllerBinaryRepository+":"+tag)
+}
+
+// ControllerBinaries returns the layer of every packed controller binary by platform
+func (o *Oci) ControllerBinaries(ctx context.Context) (map[string]ocispec.Descriptor, error) {
+	binaries := make(map[string]ocispec.Descriptor)
+	if err := o.Walk(func(reference string, desc ocispec.Descriptor) error {
+		tag := strings.TrimPrefix(reference, ControllerBinaryRepository+":")
+		if tag == reference {
+			return nil
+		}
+
+		var m ocispec.Manifest
+		if err := o.fetchJSON(ctx, desc, &m); err != nil {
+			return err
+		}
+		if len(m.Layers) != 1 {
+			return fmt.Errorf("controller binary %s has %d layers, expected 1", reference, len(m.Layers))
+		}
+
+		binaries[strings.ReplaceAll(tag, "-", "/")] = m.Layers[0]
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return binaries, nil
+}
+
+// ParsePlatform parses a platform written as os/arch[/variant]
+func ParsePlatform(platform string) (v1.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return v1.Platform{}, fmt.Errorf("platform %q must be os/arch[/variant]", platform)
+	}
+
+	p := v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
 func NewOci(root string) (*Oci, error) {
 	soci, err := store.NewOCI(root)
 	if err != nil {
@@ -116,20 +239,79 @@ func NewOci(root string) (*Oci, error) {
 	}, nil
 }
 
+// RelocationStrategy maps an image to the repository it's relocated to in an airgap registry
+type RelocationStrategy string
+
+const (
+	// RelocateRepository keeps only the image's repository, so images with the same repository in different
+	// registries collide
+	RelocateRepository RelocationStrategy = "repository"
+
+	// RelocateHost prefixes the image's repository with its source registry's host
+	RelocateHost RelocationStrategy = "host"
+
+	// RelocateHash prefixes the image's repository with a hash of its source registry's host
+	RelocateHash RelocationStrategy = "hash"
+
+	// RelocationStrategyAnnotation records the strategy a Kevi's images were packed to be relocated with
+	RelocationStrategyAnnotation = "kevi.cattle.io/relocation-strategy"
+)
+
+// ParseRelocationStrategy validates a relocation strategy, defaulting to RelocateRepository when s is empty
+func ParseRelocationStrategy(s string) (RelocationStrategy, error) {
+	switch st := RelocationStrategy(s); st {
+	case "":
+		return RelocateRepository, nil
+	case RelocateRepository, RelocateHost, RelocateHash:
+		return st, nil
+	default:
+		return "", fmt.Errorf("unknown relocation strategy %q, must be one of %s, %s or %s", s, RelocateRepository, RelocateHost, RelocateHash)
+	}
+}
+
+// Relocate relocates ref to registry with the repository strategy
 func Relocate(ref string, registry string) (string, error) {
+	return RelocateRepository.Relocate(ref, registry)
+}
+
+// Relocate relocates ref to registry, references already in registry are returned as they are
+func (s RelocationStrategy) Relocate(ref string, registry string) (string, error) {
 	or, err := name.ParseReference(ref)
 	if err != nil {
 		return "", err
 	}
 
-	relocated, err := name.ParseReference(or.Context().RepositoryStr(), name.WithDefaultRegistry(registry))
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return "", err
+	}
+	if or.Context().RegistryStr() == reg.RegistryStr() {
+		return or.Name(), nil
+	}
+
+	repo := path.Join(s.Prefix(or.Context().RegistryStr()), or.Context().RepositoryStr())
+	relocated, err := name.NewRepository(path.Join(reg.Name(), repo))
 	if err != nil {
 		return "", err
 	}
 
 	if _, err := name.NewDigest(or.Name()); err == nil {
-		return relocated.Context().Digest(or.Identifier()).Name(), nil
+		return relocated.Digest(or.Identifier()).Name(), nil
 	}
-	return relocated.Context().Tag(or.Identifier()).Name(), nil
+	return relocated.Tag(or.Identifier()).Name(), nil
+
+}
 
+// Prefix returns the path the strategy prefixes the repositories of images from a source registry with, which is empty
+// for the repository strategy
+func (s RelocationStrategy) Prefix(source string) string {
+	switch s {
+	case RelocateHost:
+		// ports aren't valid in a repository path
+		return strings.ReplaceAll(source, ":", "_")
+	case RelocateHash:
+		h := sha256.Sum256([]byte(source))
+		return hex.EncodeToString(h[:])[:12]
+	}
+	return ""
 }
@@ -2,8 +2,13 @@ package pack
 
 import (
 	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	packagesv1alpha1 "cattle.io/kevi/api/v1alpha1"
 )
 
@@ -74,3 +79,162 @@ func TestNewOci(t *testing.T) {
 		})
 	}
 }
+
+func TestRelocationStrategy_Relocate(t *testing.T) {
+	const registry = "registry.local:5000"
+
+	tests := []struct {
+		name     string
+		strategy RelocationStrategy
+		ref      string
+		want     string
+	}{
+		{
+			name:     "repository",
+			strategy: RelocateRepository,
+			ref:      "ghcr.io/foo/app:v1",
+			want:     "registry.local:5000/foo/app:v1",
+		},
+		{
+			name:     "repository from docker hub",
+			strategy: RelocateRepository,
+			ref:      "foo/app:v1",
+			want:     "registry.local:5000/foo/app:v1",
+		},
+		{
+			name:     "host",
+			strategy: RelocateHost,
+			ref:      "ghcr.io/foo/app:v1",
+			want:     "registry.local:5000/ghcr.io/foo/app:v1",
+		},
+		{
+			name:     "host from docker hub",
+			strategy: RelocateHost,
+			ref:      "foo/app:v1",
+			want:     "registry.local:5000/index.docker.io/foo/app:v1",
+		},
+		{
+			name:     "host with a port",
+			strategy: RelocateHost,
+			ref:      "quay.local:8443/foo/app@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want:     "registry.local:5000/quay.local_8443/foo/app@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			name:     "hash",
+			strategy: RelocateHash,
+			ref:      "ghcr.io/foo/app:v1",
+			want:     "registry.local:5000/0fd460f0568e/foo/app:v1",
+		},
+		{
+			name:     "already relocated",
+			strategy: RelocateHost,
+			ref:      "registry.local:5000/ghcr.io/foo/app:v1",
+			want:     "registry.local:5000/ghcr.io/foo/app:v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Relocate(tt.ref, registry)
+			if err != nil {
+				t.Fatalf("Relocate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Relocate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelocationStrategy_Collisions(t *testing.T) {
+	for _, s := range []RelocationStrategy{RelocateHost, RelocateHash} {
+		docker, _ := s.Relocate("docker.io/foo/app:v1", "registry.local")
+		ghcr, _ := s.Relocate("ghcr.io/foo/app:v1", "registry.local")
+		if docker == ghcr {
+			t.Errorf("%s relocated docker.io and ghcr.io images to the same reference %s", s, docker)
+		}
+	}
+}
+
+func TestOci_ControllerBinaries(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	bin := filepath.Join(dir, "kevi-arm64")
+	if err := os.WriteFile(bin, []byte("arm64 binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := NewOci(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.AddControllerBinary(ctx, "linux/arm64", bin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.AddControllerBinary(ctx, "arm64", bin); err == nil {
+		t.Errorf("AddControllerBinary() accepted a platform without an os")
+	}
+
+	binaries, err := o.ControllerBinaries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, ok := binaries["linux/arm64"]
+	if len(binaries) != 1 || !ok {
+		t.Fatalf("ControllerBinaries() = %v, want linux/arm64", binaries)
+	}
+
+	rc, err := o.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "arm64 binary" {
+		t.Errorf("ControllerBinaries() binary = %q, want the packed binary", data)
+	}
+}
+
+func TestOci_WalkKevis(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	bin := filepath.Join(dir, "kevi-arm64")
+	if err := os.WriteFile(bin, []byte("arm64 binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := NewOci(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.AddControllerBinary(ctx, "linux/arm64", bin); err != nil {
+		t.Fatal(err)
+	}
+
+	k := packagesv1alpha1.Kevi{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Annotations: map[string]string{RelocationStrategyAnnotation: string(RelocateHash)},
+	}}
+	if _, err := o.Pack(ctx, k); err != nil {
+		t.Fatal(err)
+	}
+
+	var kevis []*packagesv1alpha1.Kevi
+	if err := o.WalkKevis(ctx, func(reference string, k *packagesv1alpha1.Kevi) error {
+		kevis = append(kevis, k)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kevis) != 1 || kevis[0].Name != "app" {
+		t.Fatalf("WalkKevis() = %v, want only the app kevi", kevis)
+	}
+	if got := kevis[0].Annotations[RelocationStrategyAnnotation]; got != string(RelocateHash) {
+		t.Errorf("WalkKevis() relocation strategy = %s, want %s", got, RelocateHash)
+	}
+}
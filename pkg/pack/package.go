@@ -2,11 +2,19 @@ package pack
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/rancherfederal/ocil/pkg/artifacts"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"oras.land/oras-go/pkg/content"
+	"oras.land/oras-go/pkg/target"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 
 	"cattle.io/kevi/api/v1alpha1"
 	"cattle.io/kevi/pkg/fetcher"
@@ -15,60 +23,185 @@ import (
 // Package represents deployable content kevi understands that can be packaged and loaded
 type Package interface {
 	artifacts.OCICollection
+	io.Closer
 
 	Generate() ([]byte, error)
 }
 
-func Load(ctx context.Context, fetcher fetcher.Fetcher, pkg v1alpha1.KeviSpecPackage) (Package, error) {
-	mfs := content.NewMemory()
+// ErrPackageClosed is returned when generating a package whose content was removed by Close
+var ErrPackageClosed = errors.New("package is closed")
 
-	descs, err := fetcher.Fetch(ctx, mfs, pkg)
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	digest   digest.Digest
+	storeDir string
+	maxSize  int64
+}
+
+// WithDigest pins the loaded package to a specific digest instead of the package's tag
+func WithDigest(d digest.Digest) LoadOption {
+	return func(o *loadOptions) {
+		o.digest = d
+	}
+}
+
+// WithStoreDir fetches and extracts package content to disk under dir instead of in memory. The extracted content is
+// removed when the package is closed.
+func WithStoreDir(dir string) LoadOption {
+	return func(o *loadOptions) {
+		o.storeDir = dir
+	}
+}
+
+// WithMaxSize limits both the compressed and uncompressed size of a package's content, 0 disables the limit
+func WithMaxSize(size int64) LoadOption {
+	return func(o *loadOptions) {
+		o.maxSize = size
+	}
+}
+
+func Load(ctx context.Context, f fetcher.Fetcher, pkg v1alpha1.KeviSpecPackage, opts ...LoadOption) (Package, error) {
+	o := &loadOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var fopts []fetcher.Option
+	if o.digest != "" {
+		fopts = append(fopts, fetcher.WithDigest(o.digest))
+	}
+
+	store, cleanup, err := newLoadStore(o.storeDir)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
+
+	descs, err := f.Fetch(ctx, store, pkg, fopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(descs) != 1 {
+		return nil, fmt.Errorf("expected a single %s layer, got %d", pkg.Identify(), len(descs))
+	}
+	if o.maxSize > 0 && descs[0].Size > o.maxSize {
+		return nil, fmt.Errorf("package %s is %d bytes, exceeds the maximum of %d", pkg.Name, descs[0].Size, o.maxSize)
+	}
+
+	rc, err := store.Fetch(ctx, descs[0])
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
 
 	switch pkg.Identify() {
 	case v1alpha1.KeviPackageManifestType:
-		if len(descs) != 1 {
-			return nil, fmt.Errorf("expected 1 layer, got %d", len(descs))
+		if o.storeDir == "" {
+			kfs := filesys.MakeFsInMemory()
+			size, err := utgz(rc, kfs, "/", o.maxSize)
+			if err != nil {
+				return nil, err
+			}
+			return &Manifest{fs: kfs, root: "/", size: size}, nil
 		}
 
-		rc, err := mfs.Fetch(ctx, descs[0])
+		dir, err := os.MkdirTemp(o.storeDir, "manifest-")
 		if err != nil {
 			return nil, err
 		}
-		defer rc.Close()
-
-		kfs, err := utgz(rc)
+		size, err := utgz(rc, filesys.MakeFsOnDisk(), dir, o.maxSize)
 		if err != nil {
+			os.RemoveAll(dir)
 			return nil, err
 		}
-
-		return &Manifest{
-			fs: kfs,
-		}, nil
+		return &Manifest{fs: filesys.MakeFsOnDisk(), root: dir, dir: dir, size: size}, nil
 
 	case v1alpha1.KeviPackageChartType:
-		if len(descs) != 1 {
-			return nil, fmt.Errorf("expected a single chart layer, got %d", len(descs))
+		if o.storeDir == "" {
+			lr := limitGzip(rc, o.maxSize)
+			defer lr.Close()
+
+			ch, err := loader.LoadArchive(lr)
+			if err != nil {
+				return nil, err
+			}
+			return &Chart{chart: ch, size: chartSize(ch)}, nil
 		}
 
-		rc, err := mfs.Fetch(ctx, descs[0])
+		dir, err := os.MkdirTemp(o.storeDir, "chart-")
 		if err != nil {
 			return nil, err
 		}
-		defer rc.Close()
-
-		ch, err := loader.LoadArchive(rc)
+		c, err := stageChart(rc, dir, o.maxSize)
 		if err != nil {
+			os.RemoveAll(dir)
 			return nil, err
 		}
-
-		return &Chart{
-			chart: ch,
-		}, nil
+		return c, nil
 
 	default:
 		return nil, fmt.Errorf("unknown kevi package type")
 	}
 }
+
+// stageChart writes a chart's archive to dir, validating it loads within the size limit, and returns the chart backed
+// by the archive
+func stageChart(rc io.Reader, dir string, max int64) (*Chart, error) {
+	archive := filepath.Join(dir, "chart.tgz")
+	f, err := os.Create(archive)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	f, err = os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lr := limitGzip(f, max)
+	defer lr.Close()
+
+	ch, err := loader.LoadArchive(lr)
+	if err != nil {
+		return nil, err
+	}
+	return &Chart{archive: archive, dir: dir, size: chartSize(ch)}, nil
+}
+
+type loadStore interface {
+	target.Target
+	Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error)
+}
+
+// newLoadStore returns an in memory store, or a disk backed store under dir that is removed on cleanup
+func newLoadStore(dir string) (loadStore, func(), error) {
+	if dir == "" {
+		return content.NewMemory(), func() {}, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	tmp, err := os.MkdirTemp(dir, "pkg-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	s, err := content.NewOCI(tmp)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return s, cleanup, nil
+}
@@ -5,7 +5,10 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/yaml"
@@ -21,6 +24,10 @@ var defaultKnownImagePaths = []string{
 	// Pods
 	"{.spec.initContainers[*].image}",
 	"{.spec.containers[*].image}",
+
+	// CronJobs
+	"{.spec.jobTemplate.spec.template.spec.initContainers[*].image}",
+	"{.spec.jobTemplate.spec.template.spec.containers[*].image}",
 }
 
 func find(data []byte, paths ...string) []string {
@@ -58,6 +65,61 @@ func find(data []byte, paths ...string) []string {
 	return pathMatches
 }
 
+// RelocateImages rewrites every image at the known image paths of obj to registry with strategy, returning the original
+// reference of every relocated image by its relocated reference. Images that can't be parsed are left as they are.
+func RelocateImages(obj map[string]interface{}, registry string, strategy RelocationStrategy) map[string]string {
+	return RelocateImagePaths(obj, defaultKnownImagePaths, registry, strategy)
+}
+
+// RelocateImagePaths is RelocateImages for the images at the given simple jsonpaths of obj
+func RelocateImagePaths(obj map[string]interface{}, paths []string, registry string, strategy RelocationStrategy) map[string]string {
+	relocated := make(map[string]string)
+	RewriteImages(obj, paths, func(image string) string {
+		rel, err := strategy.Relocate(image, registry)
+		if err != nil {
+			return image
+		}
+		if rel != image {
+			relocated[rel] = image
+		}
+		return rel
+	})
+	return relocated
+}
+
+// RewriteImages replaces every image at the simple jsonpaths of obj, such as {.spec.containers[*].image}, with the
+// result of fn
+func RewriteImages(obj map[string]interface{}, paths []string, fn func(image string) string) {
+	for _, p := range paths {
+		rewrite(obj, strings.Split(strings.TrimPrefix(strings.Trim(p, "{}"), "."), "."), fn)
+	}
+}
+
+// rewrite replaces the strings at a simple jsonpath's fields, where a field ending in [*] matches every item of a list
+func rewrite(data interface{}, fields []string, fn func(string) string) {
+	m, ok := data.(map[string]interface{})
+	if !ok || len(fields) == 0 {
+		return
+	}
+
+	field := fields[0]
+	if strings.HasSuffix(field, "[*]") {
+		items, _ := m[strings.TrimSuffix(field, "[*]")].([]interface{})
+		for _, item := range items {
+			rewrite(item, fields[1:], fn)
+		}
+		return
+	}
+
+	if len(fields) > 1 {
+		rewrite(m[field], fields[1:], fn)
+		return
+	}
+	if s, ok := m[field].(string); ok {
+		m[field] = fn(s)
+	}
+}
+
 func parseJSONPath(data interface{}, parser *jsonpath.JSONPath, template string) ([]string, error) {
 	buf := new(bytes.Buffer)
 	if err := parser.Parse(template); err != nil {
@@ -73,46 +135,111 @@ func parseJSONPath(data interface{}, parser *jsonpath.JSONPath, template string)
 	return r, nil
 }
 
-func utgz(rc io.Reader) (filesys.FileSystem, error) {
-	mfs := filesys.MakeFsInMemory()
+// ErrPackageTooLarge is returned when a package's content exceeds the configured maximum size
+var ErrPackageTooLarge = errors.New("package exceeds the maximum size")
+
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+// newLimitedReader returns a reader that counts the bytes read, erroring once more than max bytes are read, max <= 0
+// disables the limit
+func newLimitedReader(r io.Reader, max int64) *limitedReader {
+	return &limitedReader{r: r, max: max}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.max > 0 && l.read > l.max {
+		return n, fmt.Errorf("%w of %d bytes", ErrPackageTooLarge, l.max)
+	}
+	return n, err
+}
+
+// limitGzip streams a gzip compressed reader through a decompression size limit, re-wrapping the result in an
+// uncompressed gzip stream for consumers that only accept gzip (such as helm's archive loader)
+func limitGzip(r io.Reader, max int64) io.ReadCloser {
+	if max <= 0 {
+		return io.NopCloser(r)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		defer gr.Close()
+
+		gw, err := gzip.NewWriterLevel(pw, gzip.NoCompression)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(gw, newLimitedReader(gr, max)); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gw.Close())
+	}()
+	return pr
+}
+
+// utgz decompresses a gzip compressed tarball into root of fsys, returning the number of bytes decompressed. It errors
+// if more than max bytes are decompressed, max <= 0 disables the limit, or if an entry would be written outside root.
+func utgz(rc io.Reader, fsys filesys.FileSystem, root string, max int64) (int64, error) {
 	gr, err := gzip.NewReader(rc)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer gr.Close()
 
-	tr := tar.NewReader(gr)
+	lr := newLimitedReader(gr, max)
+	tr := tar.NewReader(lr)
 
 	for {
 		header, err := tr.Next()
 		switch {
 		case err == io.EOF:
-			return mfs, nil
+			return lr.read, nil
 
 		case err != nil:
-			return nil, err
+			return 0, err
 
 		case header == nil:
 			continue
 		}
 
+		name := filepath.Join(root, header.Name)
+		if rel, err := filepath.Rel(root, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return 0, fmt.Errorf("archive entry %s is outside of the package", header.Name)
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := mfs.MkdirAll(header.Name); err != nil {
-				return nil, err
+			if err := fsys.MkdirAll(name); err != nil {
+				return 0, err
 			}
 
 		case tar.TypeReg:
-			f, err := mfs.Create(header.Name)
+			if err := fsys.MkdirAll(filepath.Dir(name)); err != nil {
+				return 0, err
+			}
+			f, err := fsys.Create(name)
 			if err != nil {
-				return nil, err
+				return 0, err
 			}
 
 			if _, err := io.Copy(f, tr); err != nil {
-				return nil, err
+				f.Close()
+				return 0, err
 			}
 			if err := f.Close(); err != nil {
-				return nil, err
+				return 0, err
 			}
 		}
 	}
@@ -0,0 +1,227 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+
+	"cattle.io/kevi/api/v1alpha1"
+)
+
+func TestUtgz_MaxSize(t *testing.T) {
+	m, err := NewManifest("raw", v1alpha1.KeviSpecPackageManifest{Path: "../../testdata/raw-manifests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.tgz()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := utgz(bytes.NewReader(data), filesys.MakeFsInMemory(), "/", 0); err != nil {
+		t.Errorf("utgz() without a limit error = %v", err)
+	}
+	if _, err := utgz(bytes.NewReader(data), filesys.MakeFsInMemory(), "/", 1<<20); err != nil {
+		t.Errorf("utgz() within the limit error = %v", err)
+	}
+	if _, err := utgz(bytes.NewReader(data), filesys.MakeFsInMemory(), "/", 64); !errors.Is(err, ErrPackageTooLarge) {
+		t.Errorf("utgz() over the limit error = %v, want %v", err, ErrPackageTooLarge)
+	}
+}
+
+func TestUtgz_OnDisk(t *testing.T) {
+	m, err := NewManifest("raw", v1alpha1.KeviSpecPackageManifest{Path: "../../testdata/raw-manifests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.tgz()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := m.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "manifest")
+	size, err := utgz(bytes.NewReader(data), filesys.MakeFsOnDisk(), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size == 0 {
+		t.Errorf("utgz() extracted size = 0")
+	}
+
+	disk := &Manifest{fs: filesys.MakeFsOnDisk(), root: dir, dir: dir, size: size}
+	got, err := disk.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Generate() on disk = %s, want %s", got, want)
+	}
+
+	if err := disk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Close() left %s on disk", dir)
+	}
+	if _, err := disk.Generate(); !errors.Is(err, ErrPackageClosed) {
+		t.Errorf("Generate() after Close() error = %v, want %v", err, ErrPackageClosed)
+	}
+}
+
+func TestStageChart(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/podinfo-6.0.3.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if _, err := stageChart(bytes.NewReader(data), dir, 1024); err == nil {
+		t.Errorf("stageChart() over the limit should error")
+	}
+
+	c, err := stageChart(bytes.NewReader(data), dir, 10<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.chart != nil {
+		t.Errorf("stageChart() kept the chart in memory")
+	}
+	if _, err := c.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Close() left %s on disk", dir)
+	}
+}
+
+func TestLimitGzip(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/podinfo-6.0.3.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lr := limitGzip(bytes.NewReader(data), 10<<20)
+	ch, err := loader.LoadArchive(lr)
+	lr.Close()
+	if err != nil {
+		t.Fatalf("LoadArchive() within the limit error = %v", err)
+	}
+	if ch.Name() != "podinfo" {
+		t.Errorf("LoadArchive() got chart %s, want podinfo", ch.Name())
+	}
+
+	lr = limitGzip(bytes.NewReader(data), 1024)
+	defer lr.Close()
+	if _, err := loader.LoadArchive(lr); err == nil {
+		t.Errorf("LoadArchive() over the limit should error")
+	}
+}
+
+func TestRelocateImages(t *testing.T) {
+	tests := []struct {
+		name          string
+		obj           string
+		wantImages    []string
+		wantRelocated int
+	}{
+		{
+			name: "deployment",
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - image: busybox
+      containers:
+      - image: ghcr.io/stefanprodan/podinfo:6.0.3
+      - image: nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000
+`,
+			wantImages: []string{
+				"registry.local:5000/library/busybox:latest",
+				"registry.local:5000/stefanprodan/podinfo:6.0.3",
+				"registry.local:5000/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			},
+			wantRelocated: 3,
+		},
+		{
+			name: "cronjob",
+			obj: `
+apiVersion: batch/v1
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - image: busybox
+          containers:
+          - image: ghcr.io/stefanprodan/podinfo:6.0.3
+`,
+			wantImages: []string{
+				"registry.local:5000/library/busybox:latest",
+				"registry.local:5000/stefanprodan/podinfo:6.0.3",
+			},
+			wantRelocated: 2,
+		},
+		{
+			name: "pod already relocated",
+			obj: `
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: registry.local:5000/library/busybox:latest
+`,
+			wantImages: []string{"registry.local:5000/library/busybox:latest"},
+		},
+		{
+			name: "no images",
+			obj: `
+apiVersion: v1
+kind: ConfigMap
+data:
+  image: busybox
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obj map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.obj), &obj); err != nil {
+				t.Fatal(err)
+			}
+
+			relocated := RelocateImages(obj, "registry.local:5000", RelocateRepository)
+			if len(relocated) != tt.wantRelocated {
+				t.Errorf("RelocateImages() relocated %d images, want %d", len(relocated), tt.wantRelocated)
+			}
+
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := find(data, defaultKnownImagePaths...)
+			if !reflect.DeepEqual(got, tt.wantImages) {
+				t.Errorf("RelocateImages() images = %v, want %v", got, tt.wantImages)
+			}
+		})
+	}
+}
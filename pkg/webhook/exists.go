@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// existenceCache caches whether images exist in a registry, both positive and negative results are kept for ttl
+type existenceCache struct {
+	ttl     time.Duration
+	timeout time.Duration
+	head    func(ctx context.Context, ref string) (bool, error)
+
+	mu      sync.Mutex
+	entries map[string]existenceEntry
+}
+
+type existenceEntry struct {
+	exists  bool
+	expires time.Time
+}
+
+// newExistenceCache returns a cache checking images exist with head, a nil head checks with a HEAD request against the
+// image's registry
+func newExistenceCache(ttl time.Duration, timeout time.Duration, head func(ctx context.Context, ref string) (bool, error)) *existenceCache {
+	if head == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		head = headImage(tr)
+	}
+
+	return &existenceCache{
+		ttl:     ttl,
+		timeout: timeout,
+		head:    head,
+		entries: make(map[string]existenceEntry),
+	}
+}
+
+// exists returns true if ref exists in its registry. Failed checks are treated as existing and aren't cached, so an
+// unreachable registry doesn't stop images from being relocated.
+func (c *existenceCache) exists(ctx context.Context, ref string) bool {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[ref]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.exists
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	exists, err := c.head(ctx, ref)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to check image exists", "image", ref)
+		return true
+	}
+
+	c.mu.Lock()
+	c.prune(now)
+	c.entries[ref] = existenceEntry{exists: exists, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return exists
+}
+
+// prune removes expired entries, so images that are no longer admitted don't accumulate. The caller must hold c.mu.
+func (c *existenceCache) prune(now time.Time) {
+	for ref, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, ref)
+		}
+	}
+}
+
+// headImage returns a check that ref exists with a HEAD request against its registry, which kevi always connects to
+// insecurely. Every check shares tr, so connections to the registry are reused.
+func headImage(tr http.RoundTripper) func(ctx context.Context, ref string) (bool, error) {
+	return func(ctx context.Context, ref string) (bool, error) {
+		r, err := name.ParseReference(ref, name.Insecure)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = remote.Head(r,
+			remote.WithContext(ctx),
+			remote.WithTransport(tr),
+			remote.WithAuthFromKeychain(authn.DefaultKeychain))
+
+		var terr *transport.Error
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package webhook
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	podRelocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kevi_pod_relocations_total",
+		Help: "Number of pod images observed by the pod relocator, by source registry and result",
+	}, []string{"registry", "result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(podRelocations)
+}
@@ -2,36 +2,148 @@ package webhook
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"cattle.io/kevi/pkg/pack"
 )
 
-func AddPodRelocatorToManager(mgr manager.Manager, registry string) error {
+const (
+	// RelocateOptOut is a label or annotation that disables relocating the images of a pod, or of every pod in a
+	// namespace, when set to "false"
+	RelocateOptOut = "kevi.cattle.io/relocate"
+
+	// RegistryAnnotation overrides the registry the images of pods in a namespace are relocated to
+	RegistryAnnotation = "kevi.cattle.io/registry"
+
+	// OriginalImagesAnnotation records the original image of every relocated container of a pod, by container name,
+	// and of every relocated image of other resources, by relocated image
+	OriginalImagesAnnotation = "kevi.cattle.io/original-images"
+
+	// RelocatedLabel marks pods whose images were relocated, so controllers can watch just those pods
+	RelocatedLabel = "kevi.cattle.io/relocated"
+)
+
+// DefaultExcludedNamespaces are the namespaces whose pods are never relocated by default
+var DefaultExcludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease", "kevi-system"}
+
+// RelocatorOption configures the pod relocator
+type RelocatorOption func(*podRelocatorHandler)
+
+// WithExcludedNamespaces never relocates pods in the given namespaces, regardless of the webhook's selectors
+func WithExcludedNamespaces(namespaces ...string) RelocatorOption {
+	return func(h *podRelocatorHandler) {
+		h.excluded = make(map[string]bool)
+		for _, ns := range namespaces {
+			h.excluded[ns] = true
+		}
+	}
+}
+
+// WithExistenceCheck only relocates images that exist in the registry, checked with a HEAD request bounded by timeout
+// and cached for ttl
+func WithExistenceCheck(ttl time.Duration, timeout time.Duration) RelocatorOption {
+	return func(h *podRelocatorHandler) {
+		h.exists = newExistenceCache(ttl, timeout, nil)
+	}
+}
+
+// WithPullSecret adds the named Secret to the imagePullSecrets of pods whose images are relocated
+func WithPullSecret(name string) RelocatorOption {
+	return func(h *podRelocatorHandler) {
+		h.pullSecret = name
+	}
+}
+
+// WithImageRules also relocates the images at the rules' paths in resources other than pods
+func WithImageRules(rules ...ImageRule) RelocatorOption {
+	return func(h *podRelocatorHandler) {
+		h.rules = make(map[schema.GroupResource][]string)
+		for _, r := range rules {
+			h.rules[r.GroupResource] = append(h.rules[r.GroupResource], r.Paths...)
+		}
+	}
+}
+
+// WithStrict denies pods with images missing from the registry, instead of leaving their images as they are
+func WithStrict() RelocatorOption {
+	return func(h *podRelocatorHandler) {
+		h.strict = true
+	}
+}
+
+// AddPodRelocatorToManager registers the webhook relocating the images of pods, and of the resources matching any image
+// rules, sharing one relocation log between them
+func AddPodRelocatorToManager(mgr manager.Manager, registry string, strategy pack.RelocationStrategy, opts ...RelocatorOption) error {
+	h := &podRelocatorHandler{
+		client:      mgr.GetClient(),
+		recorder:    mgr.GetEventRecorderFor("kevi-pod-relocator"),
+		relocations: newRelocationLog(),
+		registry:    registry,
+		strategy:    strategy,
+	}
+	WithExcludedNamespaces(DefaultExcludedNamespaces...)(h)
+	for _, o := range opts {
+		o(h)
+	}
+	if h.strict && h.exists == nil {
+		return fmt.Errorf("strict relocation requires an existence check")
+	}
+
 	wh := &admission.Webhook{
-		Handler: &podRelocatorHandler{
-			registry: registry,
-		},
+		Handler: h,
 	}
 
 	server := mgr.GetWebhookServer()
 	server.Register("/mutate", wh)
+	if len(h.rules) > 0 {
+		server.Register("/mutate-resources", &admission.Webhook{Handler: &resourceRelocatorHandler{pods: h}})
+	}
 	server.StartedChecker()
-	return nil
+
+	return mgr.AddMetricsExtraHandler("/relocations", h.relocations)
 }
 
 var _ admission.Handler = &podRelocatorHandler{}
 
 type podRelocatorHandler struct {
 	decoder  *admission.Decoder
+	client   client.Reader
+	recorder record.EventRecorder
 	registry string
+
+	// relocations records every image mapping the handler observes
+	relocations *relocationLog
+
+	// excluded are namespaces whose pods are never relocated
+	excluded map[string]bool
+
+	strategy pack.RelocationStrategy
+
+	// exists checks relocated images exist in the registry, nil relocates every image
+	exists *existenceCache
+	strict bool
+
+	// pullSecret is added to the imagePullSecrets of relocated pods when set
+	pullSecret string
+
+	// rules are the image paths of the other resources relocated by the resource relocator
+	rules map[schema.GroupResource][]string
 }
 
 func (m *podRelocatorHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
@@ -44,27 +156,64 @@ func (m *podRelocatorHandler) Handle(ctx context.Context, req admission.Request)
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	for i, c := range pod.Spec.InitContainers {
-		rel, err := relocate(c.Image, m.registry)
-		if err != nil {
-			continue
+	if m.excluded[req.Namespace] || OptedOut(pod) {
+		return admission.Allowed("relocation is disabled for the pod")
+	}
+
+	registry, enabled, err := m.registryFor(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !enabled {
+		return admission.Allowed("relocation is disabled for the namespace")
+	}
+
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+
+	original := make(map[string]string)
+	if err := json.Unmarshal([]byte(pod.GetAnnotations()[OriginalImagesAnnotation]), &original); err != nil {
+		original = make(map[string]string)
+	}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i, c := range containers {
+			rel, err := m.relocate(ctx, eventTarget(pod), c.Image, registry)
+			if err != nil {
+				return admission.Denied(err.Error())
+			}
+			if rel != c.Image {
+				original[c.Name] = c.Image
+				containers[i].Image = rel
+			}
 		}
-		pod.Spec.InitContainers[i].Image = rel
 	}
 
-	for i, c := range pod.Spec.Containers {
-		rel, err := relocate(c.Image, m.registry)
+	if len(original) > 0 {
+		// a pod's imagePullSecrets can't be changed once it's created
+		if m.pullSecret != "" && req.Operation == admissionv1.Create && !hasPullSecret(pod, m.pullSecret) {
+			pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: m.pullSecret})
+		}
+
+		data, err := json.Marshal(original)
 		if err != nil {
-			continue
+			return admission.Errored(http.StatusInternalServerError, err)
 		}
-		pod.Spec.Containers[i].Image = rel
+		annotations := pod.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[OriginalImagesAnnotation] = string(data)
+		pod.SetAnnotations(annotations)
+
+		labels := pod.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[RelocatedLabel] = "true"
+		pod.SetLabels(labels)
 	}
-	// TODO: Do we want this behavior?
-	// If image exists in registry, relocate
-	// if _, err := remote.Head(rel, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain)); err == nil {
-	// 	fmt.Println("relocating ", c.Image, " -> ", rel.Name())
-	// 	c.Image = rel.Name()
-	// }
 
 	marshaledPod, err := json.Marshal(pod)
 	if err != nil {
@@ -80,8 +229,91 @@ func (m *podRelocatorHandler) InjectDecoder(d *admission.Decoder) error {
 	return nil
 }
 
-func relocate(original string, registry string) (string, error) {
-	relocated, err := pack.Relocate(original, registry)
+// registryFor returns the registry images in a namespace are relocated to, and false if the namespace opted out
+func (m *podRelocatorHandler) registryFor(ctx context.Context, namespace string) (string, bool, error) {
+	if m.client == nil || namespace == "" {
+		return m.registry, true, nil
+	}
+
+	var ns corev1.Namespace
+	if err := m.client.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return "", false, err
+	}
+	if OptedOut(&ns) {
+		return "", false, nil
+	}
+	if r := ns.GetAnnotations()[RegistryAnnotation]; r != "" {
+		return r, true, nil
+	}
+	return m.registry, true, nil
+}
+
+// relocate returns the image an object should use, which is the original image when it can't be relocated or is
+// missing from the registry, the error is only set when a missing image should deny the object
+func (m *podRelocatorHandler) relocate(ctx context.Context, obj runtime.Object, image string, registry string) (string, error) {
+	rel, err := relocate(image, registry, m.strategy)
+	if err != nil {
+		m.observe(obj, image, "", RelocationFailed, fmt.Sprintf("image %s couldn't be relocated: %v", image, err))
+		return image, nil
+	}
+	if rel == image {
+		return rel, nil
+	}
+
+	if m.exists == nil || m.exists.exists(ctx, rel) {
+		m.observe(obj, image, rel, RelocationRelocated, "")
+		return rel, nil
+	}
+
+	msg := fmt.Sprintf("image %s was not relocated to registry %s, expected it at %s", image, registry, rel)
+	m.observe(obj, image, rel, RelocationMissing, msg)
+	if m.strict {
+		return "", errors.New(msg)
+	}
+	return image, nil
+}
+
+// observe records an image mapping, and a warning event on the object when the mapping failed
+func (m *podRelocatorHandler) observe(obj runtime.Object, source, target, result, failure string) {
+	if m.relocations != nil {
+		m.relocations.observe(source, target, result)
+	}
+	if failure != "" && m.recorder != nil {
+		m.recorder.Event(obj, corev1.EventTypeWarning, "RelocationFailed", failure)
+	}
+}
+
+// eventTarget is the object events about a pod are recorded on, pods created by a controller aren't named yet when
+// they're admitted, so events are recorded on their controller instead
+func eventTarget(pod *corev1.Pod) runtime.Object {
+	if owner := metav1.GetControllerOf(pod); owner != nil && pod.Name == "" {
+		return &corev1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Namespace:  pod.Namespace,
+			Name:       owner.Name,
+			UID:        owner.UID,
+		}
+	}
+	return pod
+}
+
+func hasPullSecret(pod *corev1.Pod, name string) bool {
+	for _, s := range pod.Spec.ImagePullSecrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OptedOut returns true if an object disables relocation with the opt out label or annotation
+func OptedOut(meta metav1.Object) bool {
+	return meta.GetLabels()[RelocateOptOut] == "false" || meta.GetAnnotations()[RelocateOptOut] == "false"
+}
+
+func relocate(original string, registry string, strategy pack.RelocationStrategy) (string, error) {
+	relocated, err := strategy.Relocate(original, registry)
 	if err != nil {
 		return "", err
 	}
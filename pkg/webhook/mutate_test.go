@@ -1 +1,288 @@
 package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"cattle.io/kevi/pkg/pack"
+)
+
+func TestExistenceCache(t *testing.T) {
+	calls := 0
+	c := newExistenceCache(time.Minute, time.Second, func(ctx context.Context, ref string) (bool, error) {
+		calls++
+		return ref == "registry.local/foo/app:v1", nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if !c.exists(context.Background(), "registry.local/foo/app:v1") {
+			t.Errorf("exists() = false for an existing image")
+		}
+		if c.exists(context.Background(), "registry.local/foo/missing:v1") {
+			t.Errorf("exists() = true for a missing image")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("exists() checked the registry %d times, want 2", calls)
+	}
+
+	c.entries["registry.local/foo/app:v1"] = existenceEntry{exists: true, expires: time.Now().Add(-time.Second)}
+	c.exists(context.Background(), "registry.local/foo/app:v1")
+	if calls != 3 {
+		t.Errorf("exists() didn't recheck an expired result")
+	}
+
+	c.entries["registry.local/foo/missing:v1"] = existenceEntry{expires: time.Now().Add(-time.Second)}
+	c.exists(context.Background(), "registry.local/foo/other:v1")
+	if _, ok := c.entries["registry.local/foo/missing:v1"]; ok {
+		t.Errorf("exists() didn't prune an expired result")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("exists() cached %d results, want 2", len(c.entries))
+	}
+}
+
+func TestPodRelocatorHandler_Handle(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := u.Host
+
+	ref, err := name.ParseReference(reg + "/foo/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "opted-out", Labels: map[string]string{RelocateOptOut: "false"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "mirrored", Annotations: map[string]string{RegistryAnnotation: "mirror.local"}}},
+	).Build()
+
+	tests := []struct {
+		name           string
+		opts           []RelocatorOption
+		namespace      string
+		podAnnotations map[string]string
+		image          string
+		wantImage      string
+		wantAllowed    bool
+		wantEvent      bool
+		wantPullSecret bool
+	}{
+		{
+			name:        "relocates without a check",
+			image:       "ghcr.io/foo/missing:v1",
+			wantImage:   reg + "/foo/missing:v1",
+			wantAllowed: true,
+		},
+		{
+			name:        "relocates existing images",
+			opts:        []RelocatorOption{WithExistenceCheck(time.Minute, time.Second)},
+			image:       "ghcr.io/foo/app:v1",
+			wantImage:   reg + "/foo/app:v1",
+			wantAllowed: true,
+		},
+		{
+			name:        "keeps missing images",
+			opts:        []RelocatorOption{WithExistenceCheck(time.Minute, time.Second)},
+			image:       "ghcr.io/foo/missing:v1",
+			wantImage:   "ghcr.io/foo/missing:v1",
+			wantAllowed: true,
+			wantEvent:   true,
+		},
+		{
+			name:      "denies missing images when strict",
+			opts:      []RelocatorOption{WithExistenceCheck(time.Minute, time.Second), WithStrict()},
+			image:     "ghcr.io/foo/missing:v1",
+			wantEvent: true,
+		},
+		{
+			name:           "injects the pull secret into relocated pods",
+			opts:           []RelocatorOption{WithPullSecret("airgap")},
+			image:          "ghcr.io/foo/app:v1",
+			wantImage:      reg + "/foo/app:v1",
+			wantAllowed:    true,
+			wantPullSecret: true,
+		},
+		{
+			name:        "doesn't inject the pull secret into pods that aren't relocated",
+			opts:        []RelocatorOption{WithPullSecret("airgap"), WithExistenceCheck(time.Minute, time.Second)},
+			image:       "ghcr.io/foo/missing:v1",
+			wantImage:   "ghcr.io/foo/missing:v1",
+			wantAllowed: true,
+			wantEvent:   true,
+		},
+		{
+			name:        "skips excluded namespaces",
+			namespace:   "kube-system",
+			image:       "ghcr.io/foo/app:v1",
+			wantImage:   "ghcr.io/foo/app:v1",
+			wantAllowed: true,
+		},
+		{
+			name:        "skips opted out namespaces",
+			namespace:   "opted-out",
+			image:       "ghcr.io/foo/app:v1",
+			wantImage:   "ghcr.io/foo/app:v1",
+			wantAllowed: true,
+		},
+		{
+			name:           "skips opted out pods",
+			podAnnotations: map[string]string{RelocateOptOut: "false"},
+			image:          "ghcr.io/foo/app:v1",
+			wantImage:      "ghcr.io/foo/app:v1",
+			wantAllowed:    true,
+		},
+		{
+			name:        "relocates to the namespace's registry",
+			namespace:   "mirrored",
+			image:       "ghcr.io/foo/app:v1",
+			wantImage:   "mirror.local/foo/app:v1",
+			wantAllowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			h := &podRelocatorHandler{
+				client:      c,
+				recorder:    recorder,
+				relocations: newRelocationLog(),
+				registry:    reg,
+				strategy:    pack.RelocateRepository,
+			}
+			WithExcludedNamespaces(DefaultExcludedNamespaces...)(h)
+			for _, o := range tt.opts {
+				o(h)
+			}
+			if err := h.InjectDecoder(decoder); err != nil {
+				t.Fatal(err)
+			}
+
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "default"
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Annotations: tt.podAnnotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: tt.image}}},
+			}
+			raw, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := h.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Namespace: namespace,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if resp.Allowed != tt.wantAllowed {
+				t.Fatalf("Handle() allowed = %v, want %v: %s", resp.Allowed, tt.wantAllowed, resp.Result.Message)
+			}
+			if got := len(recorder.Events) > 0; got != tt.wantEvent {
+				t.Errorf("Handle() recorded an event = %v, want %v", got, tt.wantEvent)
+			}
+			if !tt.wantAllowed {
+				return
+			}
+
+			image := tt.image
+			var original string
+			pullSecret, labelled := false, false
+			for _, p := range resp.Patches {
+				switch p.Path {
+				case "/spec/imagePullSecrets":
+					pullSecret = true
+				case "/spec/containers/0/image":
+					image = p.Value.(string)
+				case "/metadata/annotations":
+					original = p.Value.(map[string]interface{})[OriginalImagesAnnotation].(string)
+				case "/metadata/labels":
+					labelled = p.Value.(map[string]interface{})[RelocatedLabel] == "true"
+				}
+			}
+			if image != tt.wantImage {
+				t.Errorf("Handle() image = %v, want %v", image, tt.wantImage)
+			}
+			if pullSecret != tt.wantPullSecret {
+				t.Errorf("Handle() injected a pull secret = %v, want %v", pullSecret, tt.wantPullSecret)
+			}
+
+			wantOriginal := ""
+			if image != tt.image {
+				wantOriginal = `{"app":"` + tt.image + `"}`
+			}
+			if original != wantOriginal {
+				t.Errorf("Handle() original images = %v, want %v", original, wantOriginal)
+			}
+			if labelled != (image != tt.image) {
+				t.Errorf("Handle() labelled the pod relocated = %v, want %v", labelled, image != tt.image)
+			}
+		})
+	}
+}
+
+func TestRelocationLog(t *testing.T) {
+	l := newRelocationLog()
+	l.observe("ghcr.io/foo/b:v1", "registry.local/foo/b:v1", RelocationMissing)
+	l.observe("ghcr.io/foo/a:v1", "registry.local/foo/a:v1", RelocationRelocated)
+	l.observe("ghcr.io/foo/a:v1", "registry.local/foo/a:v1", RelocationRelocated)
+
+	all := l.list("")
+	if len(all) != 2 || all[0].Source != "ghcr.io/foo/a:v1" || all[0].Count != 2 {
+		t.Errorf("list() = %+v, want both mappings ordered by source", all)
+	}
+
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest("GET", "/relocations?result=missing", nil))
+
+	var missing []Relocation
+	if err := json.Unmarshal(rec.Body.Bytes(), &missing); err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].Source != "ghcr.io/foo/b:v1" {
+		t.Errorf("ServeHTTP() = %+v, want only the missing mapping", missing)
+	}
+	l.max = 2
+	l.entries["ghcr.io/foo/b:v1|registry.local/foo/b:v1|missing"].LastSeen = time.Now().Add(-time.Minute)
+	l.observe("ghcr.io/foo/c:v1", "registry.local/foo/c:v1", RelocationRelocated)
+	if _, ok := l.entries["ghcr.io/foo/b:v1|registry.local/foo/b:v1|missing"]; ok || len(l.entries) != 2 {
+		t.Errorf("observe() kept %+v, want the least recently seen mapping dropped", l.list(""))
+	}
+}
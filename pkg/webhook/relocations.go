@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	// RelocationRelocated is an image that was rewritten to the registry
+	RelocationRelocated = "relocated"
+
+	// RelocationMissing is an image that was never relocated to the registry
+	RelocationMissing = "missing"
+
+	// RelocationFailed is an image that couldn't be mapped to the registry
+	RelocationFailed = "failed"
+
+	// maxRelocations bounds the mappings a relocationLog keeps, the least recently seen are dropped first
+	maxRelocations = 1024
+)
+
+// Relocation is an image mapping observed by the pod relocator
+type Relocation struct {
+	Source   string    `json:"source"`
+	Target   string    `json:"target,omitempty"`
+	Result   string    `json:"result"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// relocationLog records the most recently seen image mappings the pod relocator observes, and serves them as JSON
+type relocationLog struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*Relocation
+}
+
+func newRelocationLog() *relocationLog {
+	return &relocationLog{max: maxRelocations, entries: make(map[string]*Relocation)}
+}
+
+func (l *relocationLog) observe(source, target, result string) {
+	podRelocations.WithLabelValues(sourceRegistry(source), result).Inc()
+
+	key := source + "|" + target + "|" + result
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		if len(l.entries) >= l.max {
+			l.evictOldest()
+		}
+		e = &Relocation{Source: source, Target: target, Result: result}
+		l.entries[key] = e
+	}
+	e.Count++
+	e.LastSeen = time.Now()
+}
+
+// evictOldest drops the least recently seen mapping. The caller must hold l.mu.
+func (l *relocationLog) evictOldest() {
+	var (
+		oldest string
+		seen   time.Time
+	)
+	for key, e := range l.entries {
+		if oldest == "" || e.LastSeen.Before(seen) {
+			oldest, seen = key, e.LastSeen
+		}
+	}
+	delete(l.entries, oldest)
+}
+
+// sourceRegistry returns the registry of an image, which unlike the image itself is bounded enough to be a label
+func sourceRegistry(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "unknown"
+	}
+	return ref.Context().RegistryStr()
+}
+
+// list returns the observed mappings ordered by source image, only those with result when it's set
+func (l *relocationLog) list(result string) []Relocation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := []Relocation{}
+	for _, e := range l.entries {
+		if result == "" || e.Result == result {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Source != out[j].Source {
+			return out[i].Source < out[j].Source
+		}
+		return out[i].Target < out[j].Target
+	})
+	return out
+}
+
+// ServeHTTP lists the observed mappings, filtered by the result query parameter, such as ?result=missing to find
+// images that are requested but were never packed
+func (l *relocationLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.list(r.URL.Query().Get("result"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
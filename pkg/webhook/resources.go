@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"cattle.io/kevi/pkg/pack"
+)
+
+// imagePathField is a field of an image rule's path, optionally matching every item of a list
+var imagePathField = regexp.MustCompile(`^[A-Za-z0-9_-]+(\[\*\])?$`)
+
+// ImageRule relocates the images at simple jsonpaths, such as {.spec.image}, of a resource other than pods
+type ImageRule struct {
+	schema.GroupResource
+	Paths []string
+}
+
+// ParseImageRule parses a rule written as resource.group=path[,path...], such as
+// prometheuses.monitoring.coreos.com={.spec.image}
+func ParseImageRule(s string) (ImageRule, error) {
+	resource, paths := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		resource, paths = s[:i], s[i+1:]
+	}
+	if resource == "" || paths == "" {
+		return ImageRule{}, fmt.Errorf("image rule %q must be resource.group=path[,path...]", s)
+	}
+
+	rule := ImageRule{GroupResource: schema.ParseGroupResource(resource)}
+	for _, p := range strings.Split(paths, ",") {
+		if !strings.HasPrefix(p, "{.") || !strings.HasSuffix(p, "}") {
+			return ImageRule{}, fmt.Errorf("image rule %q path %q must be a jsonpath such as {.spec.image}", s, p)
+		}
+		for _, f := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(p, "{."), "}"), ".") {
+			if !imagePathField.MatchString(f) {
+				return ImageRule{}, fmt.Errorf("image rule %q path %q only supports fields and [*]", s, p)
+			}
+		}
+		rule.Paths = append(rule.Paths, p)
+	}
+	return rule, nil
+}
+
+func (r ImageRule) String() string {
+	return r.GroupResource.String() + "=" + strings.Join(r.Paths, ",")
+}
+
+var _ admission.Handler = &resourceRelocatorHandler{}
+
+// resourceRelocatorHandler relocates the images of resources matching the pod relocator's image rules, such as the
+// custom resources of operators that create pods themselves
+type resourceRelocatorHandler struct {
+	pods *podRelocatorHandler
+}
+
+func (h *resourceRelocatorHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	paths := h.pods.rules[schema.GroupResource{Group: req.Resource.Group, Resource: req.Resource.Resource}]
+	if len(paths) == 0 || req.SubResource != "" {
+		return admission.Allowed("no image rules match the resource")
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if h.pods.excluded[req.Namespace] || OptedOut(obj) {
+		return admission.Allowed("relocation is disabled for the resource")
+	}
+
+	registry, enabled, err := h.pods.registryFor(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !enabled {
+		return admission.Allowed("relocation is disabled for the namespace")
+	}
+
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(req.Namespace)
+	}
+
+	original := make(map[string]string)
+	if err := json.Unmarshal([]byte(obj.GetAnnotations()[OriginalImagesAnnotation]), &original); err != nil {
+		original = make(map[string]string)
+	}
+
+	var denied error
+	pack.RewriteImages(obj.Object, paths, func(image string) string {
+		rel, err := h.pods.relocate(ctx, obj, image, registry)
+		if err != nil {
+			denied = err
+			return image
+		}
+		if rel != image {
+			original[rel] = image
+		}
+		return rel
+	})
+	if denied != nil {
+		return admission.Denied(denied.Error())
+	}
+
+	if len(original) > 0 {
+		data, err := json.Marshal(original)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[OriginalImagesAnnotation] = string(data)
+		obj.SetAnnotations(annotations)
+	}
+
+	marshaled, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"cattle.io/kevi/pkg/pack"
+)
+
+func TestParseImageRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{rule: "prometheuses.monitoring.coreos.com={.spec.image}", want: "prometheuses.monitoring.coreos.com={.spec.image}"},
+		{rule: "clusters.postgresql.cnpg.io={.spec.imageName},{.spec.sidecars[*].image}", want: "clusters.postgresql.cnpg.io={.spec.imageName},{.spec.sidecars[*].image}"},
+		{rule: "configmaps={.data.image}", want: "configmaps={.data.image}"},
+		{rule: "prometheuses.monitoring.coreos.com", wantErr: true},
+		{rule: "prometheuses.monitoring.coreos.com=.spec.image", wantErr: true},
+		{rule: "prometheuses.monitoring.coreos.com={.spec.containers[0].image}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseImageRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseImageRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseImageRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceRelocatorHandler_Handle(t *testing.T) {
+	rule, err := ParseImageRule("prometheuses.monitoring.coreos.com={.spec.image},{.spec.containers[*].image}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "opted-out", Labels: map[string]string{RelocateOptOut: "false"}}},
+	).Build()
+
+	prometheus := `{"apiVersion":"monitoring.coreos.com/v1","kind":"Prometheus","metadata":{"name":"k8s"},` +
+		`"spec":{"image":"quay.io/prometheus/prometheus:v2.32.1","containers":[{"name":"sidecar","image":"busybox"}]}}`
+
+	tests := []struct {
+		name        string
+		resource    metav1.GroupVersionResource
+		namespace   string
+		wantPatches map[string]interface{}
+	}{
+		{
+			name:      "relocates the images of matching resources",
+			resource:  metav1.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheuses"},
+			namespace: "default",
+			wantPatches: map[string]interface{}{
+				"/spec/image":              "registry.local/prometheus/prometheus:v2.32.1",
+				"/spec/containers/0/image": "registry.local/library/busybox:latest",
+			},
+		},
+		{
+			name:      "ignores resources without rules",
+			resource:  metav1.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "alertmanagers"},
+			namespace: "default",
+		},
+		{
+			name:      "skips opted out namespaces",
+			resource:  metav1.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheuses"},
+			namespace: "opted-out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods := &podRelocatorHandler{
+				client:   c,
+				registry: "registry.local",
+				strategy: pack.RelocateRepository,
+			}
+			WithImageRules(rule)(pods)
+			h := &resourceRelocatorHandler{pods: pods}
+
+			resp := h.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  tt.resource,
+				Namespace: tt.namespace,
+				Object:    runtime.RawExtension{Raw: []byte(prometheus)},
+			}})
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied the resource: %s", resp.Result.Message)
+			}
+
+			images := 0
+			for _, p := range resp.Patches {
+				want, ok := tt.wantPatches[p.Path]
+				if !ok {
+					continue
+				}
+				images++
+				if p.Value != want {
+					t.Errorf("Handle() %s = %v, want %v", p.Path, p.Value, want)
+				}
+			}
+			if images != len(tt.wantPatches) {
+				t.Errorf("Handle() patched %d images, want %d: %v", images, len(tt.wantPatches), resp.Patches)
+			}
+			if len(tt.wantPatches) == 0 && len(resp.Patches) != 0 {
+				t.Errorf("Handle() patches = %v, want none", resp.Patches)
+			}
+		})
+	}
+}